@@ -0,0 +1,105 @@
+package apns
+
+import (
+	"context"
+	"sync"
+)
+
+// DefaultMaxBatchBytes is the most that's written to the gateway at
+// once, when packing several notifications together, if MaxBatchBytes
+// isn't set on the Client.
+const DefaultMaxBatchBytes = 64 * 1024
+
+// The most notifications a queue worker takes at once, so that a
+// burst is still spread across the pool's connections.
+const maxCoalesced = 100
+
+func (client *Client) maxBatchBytes() int {
+	if client.MaxBatchBytes > 0 {
+		return client.MaxBatchBytes
+	}
+	return DefaultMaxBatchBytes
+}
+
+// SendBatch sends your push notifications in order, packing their
+// frames into as few writes as MaxBatchBytes allows, and returns a
+// response for each of them in the same order.
+//
+// On a persistent client the responses only say whether each
+// notification was written; what Apple made of them is reported to
+// the ErrorHandler and Results channel, as with Send. Otherwise a
+// connection is opened for the batch and SendBatch waits for Apple's
+// verdict on every notification: rejected as soon as Apple says so,
+// accepted once a later one is rejected or TimeoutSeconds pass
+// without complaint. Either way, anything Apple dropped after
+// rejecting a notification is written again.
+func (client *Client) SendBatch(pns []*PushNotification) (resps []*PushNotificationResponse) {
+	return client.SendBatchContext(context.Background(), pns)
+}
+
+// SendBatchContext is like SendBatch, but gives up once the context
+// is cancelled or its deadline passes. Notifications that are still
+// awaiting Apple's verdict at that point fail with the context's error.
+func (client *Client) SendBatchContext(ctx context.Context, pns []*PushNotification) (resps []*PushNotificationResponse) {
+	if client.Persistent {
+		return client.Pool().SendBatchContext(ctx, pns)
+	}
+
+	var mu sync.Mutex
+	outcomes := make(map[*PushNotification]*PushNotificationResponse)
+	reported := make(chan struct{}, 1)
+
+	conn := NewConnection(client)
+	conn.report = func(results []result) {
+		mu.Lock()
+		for _, r := range results {
+			outcomes[r.pn] = r.resp
+		}
+		mu.Unlock()
+
+		select {
+		case reported <- struct{}{}:
+		default:
+		}
+	}
+	defer conn.Close()
+
+	resps = conn.SendBatchContext(ctx, pns)
+
+	// Wait for a verdict on everything that was written.
+	mu.Lock()
+	defer mu.Unlock()
+	for {
+		waiting := false
+		for i, resp := range resps {
+			if !resp.Success {
+				continue
+			}
+			if outcome, ok := outcomes[pns[i]]; ok {
+				resps[i] = outcome
+			} else {
+				waiting = true
+			}
+		}
+		if !waiting {
+			return
+		}
+
+		mu.Unlock()
+		select {
+		case <-reported:
+			mu.Lock()
+		case <-ctx.Done():
+			mu.Lock()
+			for i, resp := range resps {
+				if _, ok := outcomes[pns[i]]; resp.Success && !ok {
+					resps[i] = new(PushNotificationResponse)
+					resps[i].Identifier = pns[i].Identifier
+					resps[i].Success = false
+					resps[i].Error = ctx.Err()
+				}
+			}
+			return
+		}
+	}
+}
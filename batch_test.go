@@ -0,0 +1,98 @@
+package apns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSendBatch(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[3] = 8
+
+	invalid := mockNotification(4)
+	invalid.DeviceToken = "abc"
+	pns := []*PushNotification{mockNotification(1), mockNotification(2), mockNotification(3), invalid}
+
+	resps := g.client().SendBatch(pns)
+	if len(resps) != len(pns) {
+		t.Fatal("expected a response per notification; got", len(resps))
+	}
+	if !resps[0].Success || !resps[1].Success {
+		t.Error("expected notifications 1 and 2 to be accepted; got", resps[0].Error, resps[1].Error)
+	}
+	if resps[2].Success || resps[2].Identifier != 3 || resps[2].AppleResponse != "INVALID_TOKEN" {
+		t.Error("expected notification 3 to be rejected; got", resps[2].Identifier, resps[2].AppleResponse)
+	}
+	if resps[3].Success || resps[3].Error == nil {
+		t.Error("expected notification 4 not to be encoded")
+	}
+	if g.dialCount() != 1 {
+		t.Error("expected a single connection; got", g.dialCount(), "dials")
+	}
+}
+
+func TestPersistentSendBatch(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[3] = 8
+
+	failed := make(chan *PushNotification, 5)
+	client := g.client()
+	client.Persistent = true
+	client.MaxBatchBytes = 200 // a couple of notifications per write
+	client.ErrorHandler = func(pn *PushNotification, resp *PushNotificationResponse) {
+		failed <- pn
+	}
+	defer client.Close()
+
+	// The clashing identifiers must be told apart.
+	pns := []*PushNotification{mockNotification(1), mockNotification(1), mockNotification(3), mockNotification(4), mockNotification(5)}
+	for i, resp := range client.SendBatch(pns) {
+		if !resp.Success {
+			t.Fatal("expected notification", i, "to be written; got", resp.Error)
+		}
+	}
+	if pns[0].Identifier == pns[1].Identifier {
+		t.Error("expected a fresh identifier for the duplicate")
+	}
+
+	select {
+	case pn := <-failed:
+		if pn != pns[2] {
+			t.Error("expected the third notification to be rejected; got", pn.Identifier)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the rejection to be reported")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for g.receivedCount(4) == 0 || g.receivedCount(5) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected notifications 4 and 5 to be resent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendBatchOverflowsResendBuffer(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[4] = 8
+
+	client := g.client()
+	client.ResendBufferSize = 2
+
+	// Only 3 and 4 are still remembered when Apple rejects 4,
+	// so there's no telling what became of 1 and 2.
+	pns := []*PushNotification{mockNotification(1), mockNotification(2), mockNotification(3), mockNotification(4)}
+	resps := client.SendBatch(pns)
+	for _, resp := range resps[:2] {
+		if resp.Success || resp.Error != ErrUnconfirmed {
+			t.Error("expected notification", resp.Identifier, "to be unconfirmed; got", resp.Error)
+		}
+	}
+	if !resps[2].Success {
+		t.Error("expected notification 3 to be accepted; got", resps[2].Error)
+	}
+	if resps[3].Success || resps[3].AppleResponse != "INVALID_TOKEN" {
+		t.Error("expected notification 4 to be rejected; got", resps[3].AppleResponse)
+	}
+}
@@ -0,0 +1,132 @@
+package apns
+
+import (
+	"crypto/tls"
+)
+
+// LoadClient is like NewClient, but loads the certificate and
+// key up front, returning an error if they can't be used.
+func LoadClient(gateway, certificateFile, keyFile string) (*Client, error) {
+	c := NewClient(gateway, certificateFile, keyFile)
+	if _, err := c.TLSConfig(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadBareClient is like BareClient, but parses the certificate
+// and key blocks up front, returning an error if they can't be used.
+func LoadBareClient(gateway, certificateBase64, keyBase64 string) (*Client, error) {
+	c := BareClient(gateway, certificateBase64, keyBase64)
+	if _, err := c.TLSConfig(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TLSConfig returns the TLS configuration shared by the client's
+// connections, loading its certificate and key the first time it's
+// called. Connections use a copy with ServerName set to the host they
+// dial, so the returned configuration must not be modified.
+//
+// The configuration always presents the client's current certificate,
+// so a certificate swapped in by ReloadCertificate is used by every
+// connection made afterwards.
+func (client *Client) TLSConfig() (*tls.Config, error) {
+	client.tlsMu.Lock()
+	defer client.tlsMu.Unlock()
+
+	if client.tlsConfig != nil {
+		return client.tlsConfig, nil
+	}
+
+	cert, err := client.loadCertificate()
+	if err != nil {
+		return nil, err
+	}
+	client.useCertificate(cert)
+	return client.tlsConfig, nil
+}
+
+// useCertificate builds the client's TLS configuration around an
+// already loaded certificate. The caller must hold client.tlsMu.
+func (client *Client) useCertificate(cert tls.Certificate) {
+	client.cert.Store(&cert)
+	client.tlsConfig = &tls.Config{
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return client.currentCertificate(), nil
+		},
+	}
+}
+
+// currentCertificate returns the certificate most recently
+// loaded, or nil if there isn't one yet.
+func (client *Client) currentCertificate() *tls.Certificate {
+	cert, _ := client.cert.Load().(*tls.Certificate)
+	return cert
+}
+
+// hasCertificate reports whether the client has
+// a certificate to present, loaded or not.
+func (client *Client) hasCertificate() bool {
+	client.tlsMu.Lock()
+	defer client.tlsMu.Unlock()
+	return client.tlsConfig != nil || len(client.CertificateFile) > 0 || len(client.CertificateBase64) > 0
+}
+
+// Certificate returns the certificate the client presents to Apple,
+// loading it first if need be.
+func (client *Client) Certificate() (*tls.Certificate, error) {
+	if _, err := client.TLSConfig(); err != nil {
+		return nil, err
+	}
+	return client.currentCertificate(), nil
+}
+
+// ReloadCertificate loads the client's certificate and key again,
+// atomically swapping them in for subsequent connections. If they
+// can't be loaded, the error is returned and the client carries on
+// using the last good certificate.
+func (client *Client) ReloadCertificate() error {
+	if _, err := client.TLSConfig(); err != nil {
+		return err
+	}
+	cert, err := client.loadCertificate()
+	if err != nil {
+		return err
+	}
+	client.cert.Store(&cert)
+	return nil
+}
+
+// loadCertificate reads the client's certificate and key,
+// decrypting the key first if a passphrase was supplied.
+func (client *Client) loadCertificate() (tls.Certificate, error) {
+	if client.hasPassphrase() {
+		return client.loadEncryptedCertificate()
+	}
+	if len(client.CertificateBase64) == 0 && len(client.KeyBase64) == 0 {
+		// The user did not specify raw block contents, so check the filesystem.
+		return tls.LoadX509KeyPair(client.CertificateFile, client.KeyFile)
+	}
+	// The user provided the raw block contents, so use that.
+	return tls.X509KeyPair([]byte(client.CertificateBase64), []byte(client.KeyBase64))
+}
+
+// loadEncryptedCertificate reads the client's certificate and
+// decrypts its key in memory before pairing them up.
+func (client *Client) loadEncryptedCertificate() (tls.Certificate, error) {
+	certPEM, keyPEM, err := client.readKeyPair()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	passphrase, err := client.passphrase()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	keyPEM, err = decryptPEMKey(keyPEM, passphrase)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
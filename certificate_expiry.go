@@ -0,0 +1,149 @@
+package apns
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultExpiryThresholds are the points at which an ExpiryMonitor
+// warns about the certificate when no thresholds are given.
+var DefaultExpiryThresholds = []time.Duration{
+	30 * 24 * time.Hour,
+	7 * 24 * time.Hour,
+	24 * time.Hour,
+}
+
+// DefaultExpiryCheckInterval is how often an ExpiryMonitor looks at
+// the certificate when no positive interval is given.
+const DefaultExpiryCheckInterval = time.Hour
+
+// The number of seconds left before each monitored certificate
+// expires, keyed by subject, published for expvar consumers.
+var certificateExpiry = expvar.NewMap("apns_certificate_expiry_seconds")
+
+// CertificateExpiredError is returned instead of attempting to
+// connect once the client's certificate has expired, since Apple
+// would only reject the TLS handshake.
+type CertificateExpiredError struct {
+	Subject  string
+	NotAfter time.Time
+}
+
+func (e *CertificateExpiredError) Error() string {
+	return "certificate " + e.Subject + " expired at " + e.NotAfter.Format(time.RFC3339)
+}
+
+// checkExpiry returns a CertificateExpiredError if the
+// client's certificate has expired.
+func (client *Client) checkExpiry() error {
+	info, err := client.CertificateInfo()
+	if err != nil {
+		return err
+	}
+	if time.Now().After(info.NotAfter) {
+		return &CertificateExpiredError{info.Subject, info.NotAfter}
+	}
+	return nil
+}
+
+// ExpiryMonitor keeps an eye on when a client's certificate expires.
+// See Client.MonitorExpiry.
+type ExpiryMonitor struct {
+	client     *Client
+	thresholds []time.Duration
+	onWarning  func(info *CertificateInfo, remaining time.Duration)
+	stop       chan struct{}
+	done       chan struct{}
+
+	mu       sync.Mutex
+	notAfter time.Time
+	warned   int
+}
+
+// MonitorExpiry checks how long the client's certificate has left,
+// straight away and then every interval (DefaultExpiryCheckInterval if
+// not positive), calling onWarning as the time remaining drops below
+// each of the thresholds (DefaultExpiryThresholds if nil) and once more
+// when it expires. Each warning is given once per certificate, so
+// renewing it (see WatchCertificate) starts over.
+//
+// The seconds remaining are also published through expvar, in the
+// "apns_certificate_expiry_seconds" map keyed by certificate subject.
+func (client *Client) MonitorExpiry(interval time.Duration, thresholds []time.Duration, onWarning func(info *CertificateInfo, remaining time.Duration)) *ExpiryMonitor {
+	if interval <= 0 {
+		interval = DefaultExpiryCheckInterval
+	}
+	if thresholds == nil {
+		thresholds = DefaultExpiryThresholds
+	}
+	sorted := append([]time.Duration(nil), thresholds...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] > sorted[j] })
+
+	m := &ExpiryMonitor{
+		client:     client,
+		thresholds: append(sorted, 0),
+		onWarning:  onWarning,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	m.Check()
+
+	go m.watch(interval)
+	return m
+}
+
+// Stop stops monitoring the certificate.
+func (m *ExpiryMonitor) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+// Check looks at the certificate right away, warning if it has
+// crossed another threshold since the last check.
+func (m *ExpiryMonitor) Check() {
+	info, err := m.client.CertificateInfo()
+	if err != nil {
+		return
+	}
+	remaining := time.Until(info.NotAfter)
+
+	expiry := new(expvar.Float)
+	expiry.Set(remaining.Seconds())
+	certificateExpiry.Set(info.Subject, expiry)
+
+	m.mu.Lock()
+	if !info.NotAfter.Equal(m.notAfter) {
+		m.notAfter = info.NotAfter
+		m.warned = 0
+	}
+	// Only the last threshold crossed is worth warning about.
+	crossed := m.warned
+	for crossed < len(m.thresholds) && remaining <= m.thresholds[crossed] {
+		crossed++
+	}
+	warn := crossed > m.warned
+	m.warned = crossed
+	m.mu.Unlock()
+
+	if warn && m.onWarning != nil {
+		m.onWarning(info, remaining)
+	}
+}
+
+func (m *ExpiryMonitor) watch(interval time.Duration) {
+	defer close(m.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+			m.Check()
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package apns
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMonitorExpiry(t *testing.T) {
+	certPEM, keyPEM := mockCertificate(t, time.Now().Add(5*24*time.Hour))
+	client := BareClient("gateway.sandbox.push.apple.com:2195", string(certPEM), string(keyPEM))
+
+	var warnings []time.Duration
+	m := client.MonitorExpiry(time.Hour, nil, func(info *CertificateInfo, remaining time.Duration) {
+		warnings = append(warnings, remaining)
+	})
+	defer m.Stop()
+
+	// The 30 and 7 day thresholds were crossed before
+	// the first check, but only one warning is due.
+	if len(warnings) != 1 {
+		t.Fatal("expected a single warning; got", len(warnings))
+	}
+	if warnings[0] > 5*24*time.Hour {
+		t.Error("expected about 5 days remaining; got", warnings[0])
+	}
+
+	m.Check()
+	if len(warnings) != 1 {
+		t.Error("expected no repeated warning; got", len(warnings))
+	}
+}
+
+func TestMonitorExpiryDefaultInterval(t *testing.T) {
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	client := BareClient("gateway.sandbox.push.apple.com:2195", string(certPEM), string(keyPEM))
+
+	// A zero interval mustn't bring the monitor down.
+	m := client.MonitorExpiry(0, nil, nil)
+	m.Stop()
+}
+
+func TestExpiredCertificate(t *testing.T) {
+	certPEM, keyPEM := mockCertificate(t, time.Now().Add(-time.Hour))
+	client := BareClient("gateway.sandbox.push.apple.com:2195", string(certPEM), string(keyPEM))
+
+	err := client.ConnectAndWrite(NewPushNotificationResponse(), nil)
+	var expired *CertificateExpiredError
+	if !errors.As(err, &expired) {
+		t.Fatal("expected a CertificateExpiredError; got", err)
+	}
+	if expired.NotAfter.After(time.Now()) {
+		t.Error("expected NotAfter to be in the past; got", expired.NotAfter)
+	}
+}
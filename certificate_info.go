@@ -0,0 +1,145 @@
+package apns
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrEnvironmentMismatch is returned when VerifyEnvironment is set and
+// the client's certificate isn't valid for the gateway's environment.
+var ErrEnvironmentMismatch = errors.New("certificate is not valid for the gateway's environment")
+
+// Apple marks push certificates with these custom X.509 extensions.
+var (
+	oidAppleDevelopment = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 1}
+	oidAppleProduction  = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 2}
+	oidAppleTopics      = asn1.ObjectIdentifier{1, 2, 840, 113635, 100, 6, 3, 6}
+	oidUserID           = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+)
+
+// CertificateInfo describes what an Apple push certificate is good for.
+//
+// Development and Production report which of Apple's environments
+// the certificate may be used with; universal certificates are valid
+// for both. Topics lists every topic a universal certificate may push
+// to, such as the bundle ID and its ".voip" and ".complication"
+// variants; for older certificates it's just the bundle ID.
+type CertificateInfo struct {
+	Subject     string
+	BundleID    string
+	Topics      []string
+	Development bool
+	Production  bool
+	NotAfter    time.Time
+}
+
+// InspectCertificate reads Apple's push-specific details from a
+// certificate. Certificates that weren't issued by Apple for push
+// notifications simply report no environments and no topics.
+func InspectCertificate(cert *x509.Certificate) *CertificateInfo {
+	info := new(CertificateInfo)
+	info.Subject = cert.Subject.String()
+	info.NotAfter = cert.NotAfter
+
+	for _, name := range cert.Subject.Names {
+		if uid, ok := name.Value.(string); ok && name.Type.Equal(oidUserID) {
+			info.BundleID = uid
+		}
+	}
+	if len(info.BundleID) == 0 {
+		// The common name looks like "Apple Push Services: com.example.app".
+		if i := strings.LastIndex(cert.Subject.CommonName, ": "); i >= 0 {
+			info.BundleID = cert.Subject.CommonName[i+2:]
+		}
+	}
+
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidAppleDevelopment):
+			info.Development = true
+		case ext.Id.Equal(oidAppleProduction):
+			info.Production = true
+		case ext.Id.Equal(oidAppleTopics):
+			info.Topics = parseTopics(ext.Value)
+		}
+	}
+	if len(info.Topics) == 0 && len(info.BundleID) > 0 {
+		info.Topics = []string{info.BundleID}
+	}
+	return info
+}
+
+// parseTopics decodes Apple's topics extension, a sequence
+// alternating between each topic's name and its type.
+func parseTopics(der []byte) (topics []string) {
+	var seq asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &seq); err != nil {
+		return
+	}
+	rest := seq.Bytes
+	for len(rest) > 0 {
+		var item asn1.RawValue
+		var err error
+		rest, err = asn1.Unmarshal(rest, &item)
+		if err != nil {
+			return
+		}
+		if item.Class == asn1.ClassUniversal && item.Tag == asn1.TagUTF8String {
+			topics = append(topics, string(item.Bytes))
+		}
+	}
+	return
+}
+
+// CertificateInfo describes the certificate the client presents to Apple.
+func (client *Client) CertificateInfo() (*CertificateInfo, error) {
+	cert, err := client.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := leafCertificate(cert)
+	if err != nil {
+		return nil, err
+	}
+	return InspectCertificate(leaf), nil
+}
+
+// leafCertificate returns the parsed leaf of a key pair.
+func leafCertificate(cert *tls.Certificate) (*x509.Certificate, error) {
+	if cert.Leaf != nil {
+		return cert.Leaf, nil
+	}
+	if len(cert.Certificate) == 0 {
+		return nil, errors.New("no certificate found")
+	}
+	return x509.ParseCertificate(cert.Certificate[0])
+}
+
+// isSandbox reports whether the client is talking to Apple's
+// development environment. With an Environment, that's one named
+// like Sandbox, whatever its addresses; without, it's guessed from
+// the host name of the address being dialed.
+func (client *Client) isSandbox(address string) bool {
+	if client.Environment != nil {
+		return client.Environment.Name == Sandbox.Name
+	}
+	return strings.Contains(hostname(address), ".sandbox.")
+}
+
+// verifyEnvironment checks that the client's certificate is valid
+// for the environment of the gateway at the given address.
+func (client *Client) verifyEnvironment(address string) error {
+	info, err := client.CertificateInfo()
+	if err != nil {
+		return err
+	}
+	sandbox := client.isSandbox(address)
+	if sandbox && !info.Development || !sandbox && !info.Production {
+		return ErrEnvironmentMismatch
+	}
+	return nil
+}
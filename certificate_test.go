@@ -0,0 +1,149 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// mockCertificate generates a self-signed push certificate for
+// com.example.app and an unencrypted key, both PEM encoded, valid
+// until notAfter.
+func mockCertificate(t *testing.T, notAfter time.Time, extensions ...pkix.Extension) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:    big.NewInt(1),
+		Subject:         pkix.Name{CommonName: "Apple Push Services: com.example.app"},
+		NotBefore:       notAfter.AddDate(-1, 0, 0),
+		NotAfter:        notAfter,
+		ExtraExtensions: extensions,
+		DNSNames:        []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func TestLoadBareClient(t *testing.T) {
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+
+	client, err := LoadBareClient("gateway.sandbox.push.apple.com:2195", string(certPEM), string(keyPEM))
+	if err != nil {
+		t.Fatal("expected the key pair to load; got", err)
+	}
+
+	first, _ := client.TLSConfig()
+	second, _ := client.TLSConfig()
+	if first != second {
+		t.Error("expected the TLS configuration to be cached")
+	}
+}
+
+func TestLoadBareClientInvalid(t *testing.T) {
+	_, err := LoadBareClient("gateway.sandbox.push.apple.com:2195", "not a certificate", "not a key")
+	if err == nil {
+		t.Error("expected an error for an invalid key pair")
+	}
+}
+
+func TestLoadClientMissingFiles(t *testing.T) {
+	_, err := LoadClient("gateway.sandbox.push.apple.com:2195", "missing-cert.pem", "missing-key.pem")
+	if err == nil {
+		t.Error("expected an error for missing certificate files")
+	}
+}
+
+// mockTopicsExtension builds Apple's topics extension, in which
+// each topic is followed by a sequence describing its type.
+func mockTopicsExtension(t *testing.T, topics ...string) pkix.Extension {
+	var items []asn1.RawValue
+	for _, topic := range topics {
+		kind, _ := asn1.MarshalWithParams("app", "utf8")
+		items = append(items,
+			asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(topic)},
+			asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: kind})
+	}
+	value, err := asn1.Marshal(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pkix.Extension{Id: oidAppleTopics, Value: value}
+}
+
+func TestInspectCertificate(t *testing.T) {
+	notAfter := time.Now().AddDate(1, 0, 0).Truncate(time.Second)
+	development := pkix.Extension{Id: oidAppleDevelopment, Value: []byte{5, 0}}
+	topics := mockTopicsExtension(t, "com.example.app", "com.example.app.voip")
+	certPEM, keyPEM := mockCertificate(t, notAfter, development, topics)
+
+	client := BareClient("gateway.sandbox.push.apple.com:2195", string(certPEM), string(keyPEM))
+	info, err := client.CertificateInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.BundleID != "com.example.app" {
+		t.Error("expected bundle ID com.example.app; got", info.BundleID)
+	}
+	if len(info.Topics) != 2 || info.Topics[1] != "com.example.app.voip" {
+		t.Error("expected the app and VoIP topics; got", info.Topics)
+	}
+	if !info.Development || info.Production {
+		t.Error("expected a development-only certificate")
+	}
+	if !info.NotAfter.Equal(notAfter) {
+		t.Error("expected NotAfter", notAfter, "; got", info.NotAfter)
+	}
+}
+
+func TestVerifyEnvironment(t *testing.T) {
+	development := pkix.Extension{Id: oidAppleDevelopment, Value: []byte{5, 0}}
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0), development)
+
+	client := BareClient("gateway.push.apple.com:2195", string(certPEM), string(keyPEM))
+	client.VerifyEnvironment = true
+	if err := client.ConnectAndWrite(NewPushNotificationResponse(), nil); err != ErrEnvironmentMismatch {
+		t.Error("expected the client to refuse to connect; got", err)
+	}
+	if err := client.verifyEnvironment(client.Gateway); err != ErrEnvironmentMismatch {
+		t.Error("expected ErrEnvironmentMismatch for the production gateway; got", err)
+	}
+	if err := client.verifyEnvironment("gateway.sandbox.push.apple.com:2195"); err != nil {
+		t.Error("expected the sandbox gateway to be allowed; got", err)
+	}
+}
+
+func TestVerifyEnvironmentNamed(t *testing.T) {
+	development := pkix.Extension{Id: oidAppleDevelopment, Value: []byte{5, 0}}
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0), development)
+
+	// A relay's host name says nothing about which of
+	// Apple's environments it forwards to.
+	client := BareClient("", string(certPEM), string(keyPEM))
+	client.Environment = CustomEnvironment("sandbox", "relay.example.com:2195", "", "")
+	if err := client.verifyEnvironment(client.gateway()); err != nil {
+		t.Error("expected the sandbox relay to be allowed; got", err)
+	}
+
+	client.Environment = CustomEnvironment("production", "relay.sandbox.example.com:2195", "", "")
+	if err := client.verifyEnvironment(client.gateway()); err != ErrEnvironmentMismatch {
+		t.Error("expected ErrEnvironmentMismatch for the production relay; got", err)
+	}
+}
@@ -0,0 +1,110 @@
+package apns
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+// CertificateWatcher keeps a client's certificate up to date with the
+// files it was loaded from. See Client.WatchCertificate.
+type CertificateWatcher struct {
+	client  *Client
+	onError func(error)
+	stop    chan struct{}
+	done    chan struct{}
+
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+// WatchCertificate polls the modification times of the client's
+// CertificateFile and KeyFile every interval, reloading them whenever
+// either changes. New connections pick up the renewed certificate;
+// existing ones carry on with the one they were established with.
+//
+// If the files can't be loaded (say, because only one of them has
+// been replaced so far) the error is passed to onError, which may be
+// nil, and the last good certificate remains in use until the files
+// change again.
+func (client *Client) WatchCertificate(interval time.Duration, onError func(error)) (*CertificateWatcher, error) {
+	if interval <= 0 {
+		return nil, errors.New("certificate watching requires a positive interval")
+	}
+	if len(client.CertificateFile) == 0 || len(client.KeyFile) == 0 {
+		return nil, errors.New("certificate watching requires CertificateFile and KeyFile")
+	}
+	if _, err := client.TLSConfig(); err != nil {
+		return nil, err
+	}
+
+	w := &CertificateWatcher{
+		client:  client,
+		onError: onError,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	w.certModTime, w.keyModTime, _ = w.modTimes()
+
+	go w.watch(interval)
+	return w, nil
+}
+
+// Stop stops watching the files. The client keeps whichever
+// certificate it had loaded last.
+func (w *CertificateWatcher) Stop() {
+	close(w.stop)
+	<-w.done
+}
+
+func (w *CertificateWatcher) watch(interval time.Duration) {
+	defer close(w.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+// check reloads the certificate if either file has changed
+// since it was last looked at.
+func (w *CertificateWatcher) check() {
+	certModTime, keyModTime, err := w.modTimes()
+	if err != nil {
+		w.report(err)
+		return
+	}
+	if certModTime.Equal(w.certModTime) && keyModTime.Equal(w.keyModTime) {
+		return
+	}
+	w.certModTime, w.keyModTime = certModTime, keyModTime
+
+	if err := w.client.ReloadCertificate(); err != nil {
+		w.report(err)
+	}
+}
+
+func (w *CertificateWatcher) modTimes() (certModTime, keyModTime time.Time, err error) {
+	certInfo, err := os.Stat(w.client.CertificateFile)
+	if err != nil {
+		return
+	}
+	keyInfo, err := os.Stat(w.client.KeyFile)
+	if err != nil {
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+func (w *CertificateWatcher) report(err error) {
+	if w.onError != nil {
+		w.onError(err)
+	}
+}
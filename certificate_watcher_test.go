@@ -0,0 +1,80 @@
+package apns
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCertificateFiles(t *testing.T, certFile, keyFile string, certPEM, keyPEM []byte, modTime time.Time) {
+	if err := os.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+}
+
+func TestWatchCertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	now := time.Now()
+	certPEM, keyPEM := mockCertificate(t, now.AddDate(0, 1, 0))
+	writeCertificateFiles(t, certFile, keyFile, certPEM, keyPEM, now.Add(-time.Hour))
+
+	client, err := LoadClient("gateway.sandbox.push.apple.com:2195", certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original, _ := client.Certificate()
+
+	errs := make(chan error, 10)
+	w, err := client.WatchCertificate(10*time.Millisecond, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	// A broken renewal is reported and the old certificate kept.
+	writeCertificateFiles(t, certFile, keyFile, []byte("garbage"), keyPEM, now.Add(-time.Minute))
+	select {
+	case <-errs:
+	case <-time.After(time.Second):
+		t.Fatal("expected the failed reload to be reported")
+	}
+	if cert, _ := client.Certificate(); cert != original {
+		t.Error("expected the last good certificate to remain in use")
+	}
+
+	renewedCert, renewedKey := mockCertificate(t, now.AddDate(1, 0, 0))
+	writeCertificateFiles(t, certFile, keyFile, renewedCert, renewedKey, now)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if cert, _ := client.Certificate(); cert != original {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the renewed certificate to be swapped in")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatchCertificateRequiresFiles(t *testing.T) {
+	client := BareClient("gateway.sandbox.push.apple.com:2195", "", "")
+	if _, err := client.WatchCertificate(time.Second, nil); err == nil {
+		t.Error("expected an error when the client has no certificate files")
+	}
+}
+
+func TestWatchCertificateInterval(t *testing.T) {
+	client := NewClient("gateway.sandbox.push.apple.com:2195", "cert.pem", "key.pem")
+	if _, err := client.WatchCertificate(0, nil); err == nil {
+		t.Error("expected an error for a zero interval")
+	}
+}
@@ -1,15 +1,23 @@
 package apns
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"net"
-	"strings"
+	"net/url"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var _ APNSClient = &Client{}
 
+// ErrUnpinnedCertificate is returned when PinnedCAs is set and the
+// server's certificate doesn't chain to any of them.
+var ErrUnpinnedCertificate = errors.New("server certificate is not issued by a pinned certificate authority")
+
 // APNSClient is an APNS client.
 type APNSClient interface {
 	ConnectAndWrite(resp *PushNotificationResponse, payload []byte) (err error)
@@ -20,18 +28,134 @@ type APNSClient interface {
 // with Apple, such as the gateway to use and your
 // certificate contents.
 //
+// Rather than a Gateway, you may set an Environment such as Sandbox
+// or Production, which also lets the same client fetch feedback
+// without being pointed at the feedback service separately.
+//
+// Notifications are written in the frame format unless Format says
+// otherwise, for the benefit of relays that only speak an older one.
+//
+// Connections are made with DialContext, if set, so that they can be
+// routed through a proxy, given timeouts and keep-alives, bound to a
+// particular source address or replaced altogether in tests; the
+// DialContext method of a net.Dialer is the usual choice.
+//
+// To tunnel connections through a proxy, set Proxy to its URL, with
+// an "http" scheme for HTTP CONNECT proxies or "socks5" for SOCKS5
+// proxies; any credentials are taken from the URL. Alternatively, set
+// ProxyFromEnvironment to use whichever proxy the HTTPS_PROXY or
+// ALL_PROXY environment variables name, respecting NO_PROXY. The
+// proxy itself is reached through DialContext.
+//
+// ConfigureTLS, if set, may adjust the TLS configuration of every
+// push and feedback connection before it's made, to set a minimum
+// version, supply RootCAs or a session cache and so on. To pin the
+// certificate authorities Apple's servers must chain to, on top of
+// the usual verification, set PinnedCAs.
+//
 // You'll need to provide your own CertificateFile
 // and KeyFile to send notifications. Ideally, you'll
 // just set the CertificateFile and KeyFile fields to
 // a location on drive where the certs can be loaded,
 // but if you prefer you can use the CertificateBase64
 // and KeyBase64 fields to store the actual contents.
+//
+// If your private key is encrypted, set KeyPassphrase or, to fetch
+// it on demand, KeyPassphraseFunc; the key is decrypted in memory.
+// Both encrypted PKCS#8 keys and legacy OpenSSL PKCS#1 and EC keys
+// are supported.
+//
+// The certificate and key are only loaded once, the first time
+// they're needed, and then shared by every push and feedback
+// connection; use LoadClient or LoadBareClient to find out about
+// problems with them straight away. Set VerifyEnvironment to refuse
+// to connect to a sandbox gateway with a production-only certificate,
+// or vice versa. The Environment says which it is: one named
+// "sandbox" is Apple's development environment and any other is taken
+// for production. Without one, a gateway whose host name contains
+// ".sandbox." is assumed to be the development environment.
+//
+// Setting Persistent keeps a single TLS session to the gateway
+// open across calls to Send instead of dialing for every
+// notification; call Close once you're done with the client.
+// PoolSize raises the number of sessions used to spread the load
+// (see Pool); it defaults to one and may be tuned with Pool().Resize,
+// although the number of goroutines writing enqueued notifications is
+// fixed when the first is enqueued (see Enqueue).
+// Since Apple only reports failures asynchronously, notifications
+// it rejects on a persistent connection are passed to ErrorHandler,
+// and those it dropped as a consequence are sent again. Up to
+// ResendBufferSize (DefaultResendBufferSize if zero) recently
+// written notifications are kept around for that purpose; one pushed
+// out before Apple could have rejected it is reported with
+// ErrUnconfirmed.
+//
+// Idle sessions are liable to be dropped silently along the way, so
+// set IdleTimeout to reconnect before writing to a session that's been
+// unused for that long; it should comfortably exceed TimeoutSeconds.
+// KeepAlive sets the period of TCP keep-alive probes on connections
+// that aren't made by DialContext, defaulting to 15 seconds; negative
+// disables them. ReconnectHandler, if set, is called with the reason
+// whenever a persistent connection replaces its session.
+//
+// Notifications sent on a persistent connection are given a fresh
+// identifier from Identifiers (or the package-level allocator, if
+// nil) when theirs clashes with one that's still in flight.
+//
+// Enqueue hands notifications to background workers instead of
+// waiting on each one; up to QueueSize (DefaultQueueSize if zero)
+// may be waiting to be written at once.
+//
+// SendBatch, and the workers behind Enqueue, pack the frames of
+// several notifications into each write of up to MaxBatchBytes
+// (DefaultMaxBatchBytes if zero), saving a TLS record apiece.
+//
+// To shut down without losing track of notifications in flight, call
+// Drain rather than Close; it waits up to GracePeriod (TimeoutSeconds
+// if zero) for Apple to reject any of them.
 type Client struct {
-	Gateway           string
-	CertificateFile   string
-	CertificateBase64 string
-	KeyFile           string
-	KeyBase64         string
+	Gateway              string
+	Environment          *Environment
+	Format               Format
+	DialContext          func(ctx context.Context, network, address string) (net.Conn, error)
+	Proxy                *url.URL
+	ProxyFromEnvironment bool
+	ConfigureTLS         func(config *tls.Config)
+	PinnedCAs            *x509.CertPool
+	CertificateFile      string
+	CertificateBase64    string
+	KeyFile              string
+	KeyBase64            string
+	KeyPassphrase        string
+	KeyPassphraseFunc    func() ([]byte, error)
+	VerifyEnvironment    bool
+	Persistent           bool
+	PoolSize             int
+	ResendBufferSize     int
+	IdleTimeout          time.Duration
+	KeepAlive            time.Duration
+	ReconnectHandler     func(cause error)
+	ErrorHandler         func(pn *PushNotification, resp *PushNotificationResponse)
+	QueueSize            int
+	MaxBatchBytes        int
+	GracePeriod          time.Duration
+	Identifiers          IdentifierAllocator
+
+	poolMu sync.Mutex
+	pool   *Pool
+
+	queueMu  sync.Mutex
+	queue    chan *PushNotification
+	stop     chan struct{}
+	workers  *sync.WaitGroup
+	results  chan *PushNotificationResponse
+	draining bool
+
+	tlsMu     sync.Mutex
+	tlsConfig *tls.Config
+
+	// cert holds the *tls.Certificate currently presented to Apple.
+	cert atomic.Value
 }
 
 // BareClient can be used to set the contents of your
@@ -57,16 +181,27 @@ func NewClient(gateway, certificateFile, keyFile string) (c *Client) {
 // Send connects to the APN service and sends your push notification.
 // Remember that if the submission is successful, Apple won't reply.
 func (client *Client) Send(pn *PushNotification) (resp *PushNotificationResponse) {
+	return client.SendContext(context.Background(), pn)
+}
+
+// SendContext is like Send, but gives up once the context is
+// cancelled or its deadline passes.
+func (client *Client) SendContext(ctx context.Context, pn *PushNotification) (resp *PushNotificationResponse) {
+	if client.Persistent {
+		return client.Pool().SendContext(ctx, pn)
+	}
+
 	resp = new(PushNotificationResponse)
+	resp.Identifier = pn.Identifier
 
-	payload, err := pn.ToBytes()
+	payload, err := client.encode(pn)
 	if err != nil {
 		resp.Success = false
 		resp.Error = err
 		return
 	}
 
-	err = client.ConnectAndWrite(resp, payload)
+	err = client.ConnectAndWriteContext(ctx, resp, payload)
 	if err != nil {
 		resp.Success = false
 		resp.Error = err
@@ -82,86 +217,240 @@ func (client *Client) Send(pn *PushNotification) (resp *PushNotificationResponse
 // ConnectAndWrite establishes the connection to Apple and handles the
 // transmission of your push notification, as well as waiting for a reply.
 //
-// In lieu of a timeout (which would be available in Go 1.1)
-// we use a timeout channel pattern instead. We start two goroutines,
-// one of which just sleeps for TimeoutSeconds seconds, while the other
-// waits for a response from the Apple servers.
-//
-// Whichever channel puts data on first is the "winner". As such, it's
-// possible to get a false positive if Apple takes a long time to respond.
-// It's probably not a deal-breaker, but something to be aware of.
+// Apple doesn't reply at all when a notification is accepted, so we wait
+// up to TimeoutSeconds seconds for an error response and assume success
+// if none arrives. As such, it's possible to get a false positive if
+// Apple takes a long time to respond. It's probably not a deal-breaker,
+// but something to be aware of.
 func (client *Client) ConnectAndWrite(resp *PushNotificationResponse, payload []byte) (err error) {
-	var cert tls.Certificate
-
-	if len(client.CertificateBase64) == 0 && len(client.KeyBase64) == 0 {
-		// The user did not specify raw block contents, so check the filesystem.
-		cert, err = tls.LoadX509KeyPair(client.CertificateFile, client.KeyFile)
-	} else {
-		// The user provided the raw block contents, so use that.
-		cert, err = tls.X509KeyPair([]byte(client.CertificateBase64), []byte(client.KeyBase64))
-	}
-
-	if err != nil {
-		return err
-	}
-
-	gatewayParts := strings.Split(client.Gateway, ":")
-	conf := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ServerName:   gatewayParts[0],
-	}
-
-	conn, err := net.Dial("tcp", client.Gateway)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
+	return client.ConnectAndWriteContext(context.Background(), resp, payload)
+}
 
-	tlsConn := tls.Client(conn, conf)
-	err = tlsConn.Handshake()
+// ConnectAndWriteContext is like ConnectAndWrite, but honours the
+// context's cancellation and deadline while dialing, during the TLS
+// handshake, while writing and while waiting for Apple's reply. A
+// deadline that falls before TimeoutSeconds is up cuts the wait short
+// and the context's error is returned.
+func (client *Client) ConnectAndWriteContext(ctx context.Context, resp *PushNotificationResponse, payload []byte) (err error) {
+	tlsConn, err := client.dialContext(ctx, client.gateway())
 	if err != nil {
 		return err
 	}
 	defer tlsConn.Close()
 
+	// Closing the connection unblocks any pending write or read.
+	stop := context.AfterFunc(ctx, func() { tlsConn.Close() })
+	defer stop()
+
 	_, err = tlsConn.Write(payload)
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return err
 	}
 
-	// Create one channel that will serve to handle
-	// timeouts when the notification succeeds.
-	timeoutChannel := make(chan bool, 1)
-	go func() {
-		time.Sleep(time.Second * TimeoutSeconds)
-		timeoutChannel <- true
-	}()
+	timer := time.NewTimer(time.Second * TimeoutSeconds)
+	defer timer.Stop()
 
-	// This channel will contain the binary response
-	// from Apple in the event of a failure.
-	responseChannel := make(chan []byte, 1)
+	// This channel will contain Apple's error response in
+	// the event of a failure, or why none could be read. The
+	// reader exits once the connection is closed on return.
+	type reply struct {
+		e   *ErrorResponse
+		err error
+	}
+	replies := make(chan reply, 1)
 	go func() {
-		buffer := make([]byte, 6, 6)
-		tlsConn.Read(buffer)
-		responseChannel <- buffer
+		e, err := readErrorResponse(tlsConn)
+		replies <- reply{e, err}
 	}()
 
 	// First one back wins!
-	// The data structure for an APN response is as follows:
-	//
-	// command    -> 1 byte
-	// status     -> 1 byte
-	// identifier -> 4 bytes
-	//
-	// The first byte will always be set to 8.
 	select {
-	case r := <-responseChannel:
+	case r := <-replies:
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		resp.Success = false
-		resp.AppleResponse = ApplePushResponses[r[1]]
-		err = errors.New(resp.AppleResponse)
-	case <-timeoutChannel:
+		if r.err != nil {
+			return r.err
+		}
+		// When shutting down, Apple reports the last notification
+		// it successfully processed, which may be ours.
+		if r.e.Status == shutdownStatus && r.e.Identifier == resp.Identifier {
+			resp.Success = true
+			return nil
+		}
+		resp.setErrorResponse(r.e)
+		return r.e
+	case <-timer.C:
 		resp.Success = true
+	case <-ctx.Done():
+		err = ctx.Err()
 	}
 
 	return err
 }
+
+// Close shuts down the persistent connections, if any are open,
+// along with the workers sending enqueued notifications; anything
+// still queued is reported as failed with ErrConnectionClosed.
+// The client may still be used afterwards; new connections
+// will be established on the next Send. See Drain for a more
+// graceful alternative.
+func (client *Client) Close() error {
+	client.stopQueue()
+
+	client.poolMu.Lock()
+	pool := client.pool
+	client.pool = nil
+	client.poolMu.Unlock()
+
+	if pool == nil {
+		return nil
+	}
+	return pool.Close()
+}
+
+// Drain shuts the client down gracefully. It stops accepting new
+// notifications, lets the workers write everything already enqueued,
+// then waits for Apple's verdict on every notification written to the
+// persistent connections for up to GracePeriod before closing them.
+// Notifications whose fate is still unknown by then are reported with
+// ErrUnconfirmed, and anything the context's end leaves queued with
+// ErrConnectionClosed.
+//
+// Like Close, Drain leaves the client usable afterwards. It returns
+// the context's error if the context ended before it was done.
+func (client *Client) Drain(ctx context.Context) error {
+	client.queueMu.Lock()
+	client.draining = true
+	client.queueMu.Unlock()
+	defer func() {
+		client.queueMu.Lock()
+		client.draining = false
+		client.queueMu.Unlock()
+	}()
+
+	client.drainQueue(ctx)
+
+	client.poolMu.Lock()
+	pool := client.pool
+	client.poolMu.Unlock()
+
+	if pool == nil {
+		return ctx.Err()
+	}
+	err := pool.Drain(ctx)
+
+	client.poolMu.Lock()
+	if client.pool == pool {
+		client.pool = nil
+	}
+	client.poolMu.Unlock()
+	return err
+}
+
+func (client *Client) gracePeriod() time.Duration {
+	if client.GracePeriod > 0 {
+		return client.GracePeriod
+	}
+	return time.Second * TimeoutSeconds
+}
+
+// Pool returns the pool of persistent connections used
+// by Send, creating it with PoolSize connections on first use.
+func (client *Client) Pool() *Pool {
+	client.poolMu.Lock()
+	defer client.poolMu.Unlock()
+
+	if client.pool == nil {
+		client.pool = NewPool(client, client.PoolSize)
+	}
+	return client.pool
+}
+
+// identifierAllocator returns the client's identifier allocator.
+func (client *Client) identifierAllocator() IdentifierAllocator {
+	if client.Identifiers != nil {
+		return client.Identifiers
+	}
+	return Identifiers
+}
+
+// dialContext connects to the given address and completes the TLS
+// handshake using the client's credentials, offering the given
+// application protocols, if any, through ALPN.
+func (client *Client) dialContext(ctx context.Context, address string, protocols ...string) (*tls.Conn, error) {
+	base, err := client.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := client.checkExpiry(); err != nil {
+		return nil, err
+	}
+	if client.VerifyEnvironment {
+		if err := client.verifyEnvironment(address); err != nil {
+			return nil, err
+		}
+	}
+
+	return client.dialTLS(ctx, address, base.Clone(), protocols...)
+}
+
+// dialTLS connects to the given address and completes the TLS
+// handshake with conf, after applying the client's TLS settings.
+func (client *Client) dialTLS(ctx context.Context, address string, conf *tls.Config, protocols ...string) (*tls.Conn, error) {
+	conf.ServerName = hostname(address)
+	conf.NextProtos = protocols
+	if client.PinnedCAs != nil {
+		conf.VerifyConnection = client.verifyPinned
+	}
+	if client.ConfigureTLS != nil {
+		client.ConfigureTLS(conf)
+	}
+
+	conn, err := client.dialConn(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, conf)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
+// verifyPinned rejects servers whose certificate
+// doesn't chain to one of the client's PinnedCAs.
+func (client *Client) verifyPinned(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return ErrUnpinnedCertificate
+	}
+	opts := x509.VerifyOptions{
+		Roots:         client.PinnedCAs,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       cs.ServerName,
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+		return ErrUnpinnedCertificate
+	}
+	return nil
+}
+
+// hostname strips the port from an address, taking care
+// of the brackets around IPv6 literals.
+func hostname(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+	return host
+}
@@ -0,0 +1,232 @@
+package apns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestHostname(t *testing.T) {
+	tests := map[string]string{
+		"gateway.push.apple.com:2195": "gateway.push.apple.com",
+		"127.0.0.1:2195":              "127.0.0.1",
+		"[::1]:2195":                  "::1",
+		"[2001:db8::1]:2195":          "2001:db8::1",
+		"localhost":                   "localhost",
+	}
+	for address, expected := range tests {
+		if host := hostname(address); host != expected {
+			t.Error("expected", expected, "for", address, "; got", host)
+		}
+	}
+}
+
+func TestDialContextHook(t *testing.T) {
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	client := BareClient("[2001:db8::1]:2195", string(certPEM), string(keyPEM))
+
+	dialErr := errors.New("no route to gateway")
+	var dialed string
+	client.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialed = address
+		return nil, dialErr
+	}
+
+	err := client.ConnectAndWrite(NewPushNotificationResponse(), nil)
+	if err != dialErr {
+		t.Error("expected the dialer's error; got", err)
+	}
+	if dialed != "[2001:db8::1]:2195" {
+		t.Error("expected the gateway to be dialed; got", dialed)
+	}
+
+	err = client.ListenForFeedback()
+	if err != dialErr || dialed != "[2001:db8::1]:2195" {
+		t.Error("expected the feedback service to be dialed through the hook; got", err)
+	}
+}
+
+func TestPinnedCAs(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[1] = 8
+
+	client := g.client()
+	client.PinnedCAs = x509.NewCertPool()
+	resp := client.Send(mockNotification(1))
+	if resp.Success || resp.Error != ErrUnpinnedCertificate {
+		t.Error("expected ErrUnpinnedCertificate; got", resp.Error)
+	}
+
+	client.PinnedCAs = g.roots
+	resp = client.Send(mockNotification(1))
+	if resp.AppleResponse != "INVALID_TOKEN" {
+		t.Error("expected to reach the gateway with the right CA pinned; got", resp.Error)
+	}
+}
+
+// stallingGateway returns a client for a gateway that accepts
+// connections but then does nothing at all, not even the TLS
+// handshake unless handshake is set, until the test ends.
+func stallingGateway(t *testing.T, handshake bool) *Client {
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	t.Cleanup(func() {
+		close(stop)
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if handshake {
+					tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}}).Handshake()
+				}
+				<-stop
+			}(conn)
+		}
+	}()
+
+	client := BareClient("localhost:2195", string(certPEM), string(keyPEM))
+	client.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, network, listener.Addr().String())
+	}
+	client.ConfigureTLS = func(config *tls.Config) {
+		config.RootCAs = roots
+	}
+	return client
+}
+
+// checkGoroutines fails the test if there are still more than
+// want goroutines running once the ones that are finishing up
+// have had a moment to do so.
+func checkGoroutines(t *testing.T, want int) {
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Error("expected", want, "goroutines; got", runtime.NumGoroutine())
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestConnectAndWriteContextHandshake(t *testing.T) {
+	client := stallingGateway(t, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.ConnectAndWriteContext(ctx, NewPushNotificationResponse(), []byte{1})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected the handshake to be cut short; got", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected to give up at the deadline; took", time.Since(start))
+	}
+}
+
+func TestConnectAndWriteContextWrite(t *testing.T) {
+	client := stallingGateway(t, true)
+
+	// Nobody reads, so writing this much blocks once
+	// the connection's buffers fill up.
+	payload := make([]byte, 64<<20)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	err := client.ConnectAndWriteContext(ctx, NewPushNotificationResponse(), payload)
+	if err != context.Canceled {
+		t.Error("expected the write to be cancelled; got", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected to give up once cancelled; took", time.Since(start))
+	}
+}
+
+func TestSendContextReplyWait(t *testing.T) {
+	g := newMockGateway(t)
+	client := g.client()
+	goroutines := runtime.NumGoroutine()
+
+	// Apple never replies to accepted notifications, so without the
+	// deadline this would wait for TimeoutSeconds.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	resp := client.SendContext(ctx, mockNotification(1))
+	if resp.Success || resp.Error != context.DeadlineExceeded {
+		t.Error("expected context.DeadlineExceeded; got", resp.Success, resp.Error)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected to give up at the deadline; took", time.Since(start))
+	}
+	if g.receivedCount(1) != 1 {
+		t.Error("expected the notification to have been written")
+	}
+	checkGoroutines(t, goroutines)
+}
+
+func TestSendContextCancelled(t *testing.T) {
+	g := newMockGateway(t)
+	client := g.client()
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	resp := client.SendContext(ctx, mockNotification(1))
+	if resp.Success || !errors.Is(resp.Error, context.Canceled) {
+		t.Error("expected context.Canceled; got", resp.Success, resp.Error)
+	}
+	checkGoroutines(t, goroutines)
+}
+
+func TestListenForFeedbackContext(t *testing.T) {
+	g := newMockGateway(t)
+	client := g.client()
+	goroutines := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := client.ListenForFeedbackContext(ctx)
+	if err != context.DeadlineExceeded {
+		t.Error("expected context.DeadlineExceeded; got", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("expected to give up at the deadline; took", time.Since(start))
+	}
+	checkGoroutines(t, goroutines)
+}
+
+func TestListenForFeedbackHandshake(t *testing.T) {
+	client := stallingGateway(t, false)
+
+	start := time.Now()
+	if err := client.ListenForFeedback(); err == nil {
+		t.Error("expected the stalled handshake to fail")
+	}
+	if elapsed := time.Since(start); elapsed > (FeedbackTimeoutSeconds+1)*time.Second {
+		t.Error("expected to give up after", FeedbackTimeoutSeconds, "seconds; took", elapsed)
+	}
+}
@@ -0,0 +1,450 @@
+package apns
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrConnectionClosed is returned when sending on a Connection
+// that has been closed.
+var ErrConnectionClosed = errors.New("connection is closed")
+
+// ErrUnconfirmed is reported for notifications that were written to
+// a connection which then closed before Apple could have rejected them,
+// so whether or not they were delivered is unknown.
+var ErrUnconfirmed = errors.New("connection closed before the notification was confirmed")
+
+// ErrIdleTimeout is passed to the ReconnectHandler when a session
+// is replaced for having been idle for longer than IdleTimeout.
+var ErrIdleTimeout = errors.New("connection was idle for too long")
+
+// Apple sends this status along with the identifier of the last
+// notification it processed when it's shutting down for maintenance.
+const shutdownStatus = 10
+
+// Connection is a long-lived TLS session to an APN gateway.
+//
+// Apple treats rapidly opening and closing connections as a
+// denial-of-service attack, so a Connection dials once and keeps
+// the session open, transparently reconnecting whenever a write
+// fails or Apple hangs up. It is safe for concurrent use by
+// multiple goroutines.
+//
+// Apple rejects a notification by sending an error response and
+// closing the connection, silently dropping anything written after
+// the bad notification. A Connection remembers the last
+// ResendBufferSize notifications it wrote so that it can report the
+// rejected one and write the rest again on a new session.
+//
+// What becomes of each notification is reported to the client's
+// ErrorHandler and Results channel: rejected as soon as Apple says
+// so, accepted once a later notification is rejected or TimeoutSeconds
+// pass without complaint.
+//
+// Apple, and NAT devices along the way, may drop a session that's
+// been idle without telling either end, and whatever is written next
+// is lost. A Connection notices as soon as the other end hangs up,
+// and with IdleTimeout set it won't trust a session that's gone
+// unused for that long, reconnecting before it writes again. The
+// client's ReconnectHandler is told each time a session is replaced,
+// and why.
+type Connection struct {
+	client *Client
+
+	mu      sync.Mutex
+	conn    *tls.Conn
+	sent    *sentBuffer
+	results []result
+	closed  bool
+
+	// While draining, no new notifications are accepted and idle,
+	// if set, is closed once nothing written awaits a verdict.
+	draining bool
+	idle     chan struct{}
+
+	// done is closed once the current session's monitor finishes.
+	done chan struct{}
+
+	// lastWrite is when the current session was last written to,
+	// and ended is why the previous one finished. Reconnections
+	// are reported along with the results.
+	lastWrite  time.Time
+	ended      error
+	reconnects []error
+
+	// report is told what became of each notification.
+	report func(results []result)
+}
+
+// NewConnection creates a Connection for the given client. No
+// network activity happens until the first notification is sent.
+func NewConnection(client *Client) *Connection {
+	return &Connection{client: client, report: client.report}
+}
+
+// Send writes your push notification to the open connection,
+// dialing first if necessary. If another notification with the same
+// Identifier might still be rejected, the notification is given a
+// fresh one from the client's allocator before it's written.
+//
+// Because Apple only replies when something goes wrong, and does so
+// asynchronously, a successful response here means the notification
+// was written to the gateway rather than that it was delivered.
+// The eventual outcome is reported to the client's ErrorHandler
+// and Results channel.
+func (c *Connection) Send(pn *PushNotification) (resp *PushNotificationResponse) {
+	return c.SendContext(context.Background(), pn)
+}
+
+// SendContext is like Send, but gives up dialing or writing
+// once the context is cancelled or its deadline passes.
+func (c *Connection) SendContext(ctx context.Context, pn *PushNotification) (resp *PushNotificationResponse) {
+	return c.SendBatchContext(ctx, []*PushNotification{pn})[0]
+}
+
+// SendBatch writes your push notifications to the open connection in
+// order, packing their frames into as few writes as MaxBatchBytes
+// allows. It returns a response for each notification, in the same
+// order, with the same meaning as those from Send.
+func (c *Connection) SendBatch(pns []*PushNotification) (resps []*PushNotificationResponse) {
+	return c.SendBatchContext(context.Background(), pns)
+}
+
+// SendBatchContext is like SendBatch, but gives up dialing or
+// writing once the context is cancelled or its deadline passes.
+func (c *Connection) SendBatchContext(ctx context.Context, pns []*PushNotification) (resps []*PushNotificationResponse) {
+	resps = make([]*PushNotificationResponse, len(pns))
+	batch := make([]sentNotification, 0, len(pns))
+	indexes := make([]int, 0, len(pns))
+	for i, pn := range pns {
+		resps[i] = new(PushNotificationResponse)
+		payload, err := c.client.encode(pn)
+		if err != nil {
+			resps[i].Identifier = pn.Identifier
+			resps[i].Success = false
+			resps[i].Error = err
+			continue
+		}
+		batch = append(batch, sentNotification{pn: pn, payload: payload})
+		indexes = append(indexes, i)
+	}
+
+	c.mu.Lock()
+	var written int
+	err := ErrConnectionClosed
+	if !c.draining {
+		written, err = c.write(ctx, batch)
+	}
+	for j, i := range indexes {
+		resps[i].Identifier = pns[i].Identifier
+		if j < written {
+			resps[i].Success = true
+		} else {
+			resps[i].Success = false
+			resps[i].Error = err
+		}
+	}
+	c.flush()
+	return
+}
+
+// Close shuts down the underlying TLS session. Any further
+// sends will fail with ErrConnectionClosed.
+func (c *Connection) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
+
+// Drain stops the connection accepting new notifications and waits
+// for Apple's verdict on those already written: until each has been
+// rejected or accepted, the client's GracePeriod passes or the context
+// ends, whichever is first. Notifications that have gone unchallenged
+// for TimeoutSeconds by then are accepted; any others are reported with
+// ErrUnconfirmed. Finally the connection is closed, as with Close, and
+// the context's error returned if it cut the wait short; in that case
+// any results not yet reported are left to be delivered in the
+// background.
+func (c *Connection) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	c.draining = true
+	idle := make(chan struct{})
+	c.idle = idle
+	c.flush()
+
+	grace := time.NewTimer(c.client.gracePeriod())
+	defer grace.Stop()
+	select {
+	case <-idle:
+	case <-grace.C:
+	case <-ctx.Done():
+	}
+
+	c.mu.Lock()
+	c.closed = true
+	c.idle = nil
+	conn, done := c.conn, c.done
+	if conn != nil {
+		for _, s := range c.sent.confirm(time.Now().Add(-time.Second * TimeoutSeconds)) {
+			c.addResult(s.pn, nil)
+		}
+	}
+	c.conn = nil
+	if conn != nil {
+		conn.Close()
+	}
+
+	// The monitor reports whatever is left once the session closes.
+	// Reporting blocks while the Results channel is full, so it's
+	// only waited for until the context ends.
+	reported := make(chan struct{})
+	go func() {
+		c.flush()
+		if conn != nil {
+			<-done
+		}
+		close(reported)
+	}()
+	select {
+	case <-reported:
+	case <-ctx.Done():
+	}
+	return ctx.Err()
+}
+
+// write sends the notifications in order, in as few writes as
+// MaxBatchBytes allows, and returns how many were written before
+// anything went wrong. The caller must hold c.mu.
+func (c *Connection) write(ctx context.Context, batch []sentNotification) (written int, err error) {
+	max := c.client.maxBatchBytes()
+	for written < len(batch) {
+		var n int
+		n, err = c.writeChunk(ctx, batch[written:], max)
+		written += n
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// writeChunk writes as many of the notifications as fit in max bytes,
+// and always at least one, in a single write, reconnecting and trying
+// once more if the existing session turns out to be broken. The
+// caller must hold c.mu.
+func (c *Connection) writeChunk(ctx context.Context, batch []sentNotification, max int) (n int, err error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		if c.closed {
+			return 0, ErrConnectionClosed
+		}
+		if c.conn != nil && c.client.IdleTimeout > 0 && time.Since(c.lastWrite) > c.client.IdleTimeout {
+			c.retire(ErrIdleTimeout)
+		}
+		if c.conn == nil {
+			c.conn, err = c.client.dialContext(ctx, c.client.gateway())
+			if err != nil {
+				c.conn = nil
+				return 0, err
+			}
+			if c.ended != nil {
+				c.reconnects = append(c.reconnects, c.ended)
+				c.ended = nil
+			}
+			c.sent = newSentBuffer(c.client.ResendBufferSize)
+			c.done = make(chan struct{})
+			go c.monitor(c.conn, c.sent, c.done)
+			go c.confirm(c.sent, c.done)
+		}
+
+		var buffer []byte
+		identifiers := make(map[int32]bool)
+		for n = 0; n < len(batch); n++ {
+			s := &batch[n]
+			if n > 0 && len(buffer)+len(s.payload) > max {
+				break
+			}
+
+			// Apple identifies rejected notifications by their identifier,
+			// so make sure it's unique among those we might resend.
+			if c.sent.has(s.pn.Identifier) || identifiers[s.pn.Identifier] {
+				s.pn.Identifier = c.client.identifierAllocator().NextIdentifier()
+				s.payload, err = c.client.encode(s.pn)
+				if err != nil {
+					return 0, err
+				}
+			}
+			identifiers[s.pn.Identifier] = true
+			buffer = append(buffer, s.payload...)
+		}
+
+		err = c.writeContext(ctx, buffer)
+		if err == nil {
+			c.lastWrite = time.Now()
+			for _, s := range batch[:n] {
+				if evicted := c.sent.add(s.pn, s.payload, c.lastWrite); evicted != nil {
+					c.addResult(evicted.pn, ErrUnconfirmed)
+				}
+			}
+			return n, nil
+		}
+		c.ended = err
+		c.conn.Close()
+		c.conn = nil
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+	}
+	return 0, err
+}
+
+// retire closes the current session so that the next write starts
+// a new one. Notifications that have gone unchallenged for
+// TimeoutSeconds are accepted; the monitor reports the rest with
+// ErrUnconfirmed. The caller must hold c.mu.
+func (c *Connection) retire(cause error) {
+	for _, s := range c.sent.confirm(time.Now().Add(-time.Second * TimeoutSeconds)) {
+		c.addResult(s.pn, nil)
+	}
+	c.ended = cause
+	c.conn.Close()
+	c.conn = nil
+}
+
+// writeContext writes the payload to the current session, bounding
+// the write by the context's deadline. The caller must hold c.mu.
+func (c *Connection) writeContext(ctx context.Context, payload []byte) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		c.conn.SetWriteDeadline(deadline)
+		defer c.conn.SetWriteDeadline(time.Time{})
+	}
+	conn := c.conn
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+// monitor waits for Apple to send an error response or hang up.
+// Either way the session is finished, so it's discarded; if Apple
+// told us which notification it stopped at, everything written
+// after that one is sent again on a fresh session.
+func (c *Connection) monitor(conn *tls.Conn, sent *sentBuffer, done chan struct{}) {
+	defer close(done)
+
+	e, err := readErrorResponse(conn)
+	conn.Close()
+
+	c.mu.Lock()
+	current := c.conn == conn
+	if current {
+		c.conn = nil
+	}
+	if err != nil {
+		if current {
+			c.ended = err
+		}
+		// Apple hung up without telling us why, so there's
+		// no way of knowing what was lost.
+		for _, s := range sent.unconfirmed() {
+			c.addResult(s.pn, ErrUnconfirmed)
+		}
+		c.flush()
+		return
+	}
+
+	accepted, failed, after := sent.split(e.Identifier)
+	if current {
+		c.ended = e
+	}
+
+	for _, s := range accepted {
+		c.addResult(s.pn, nil)
+	}
+
+	// When shutting down, Apple reports the last notification
+	// it successfully processed rather than a failed one.
+	if failed != nil {
+		if e.Status == shutdownStatus {
+			c.addResult(failed.pn, nil)
+		} else {
+			resp := new(PushNotificationResponse)
+			resp.setErrorResponse(e)
+			c.results = append(c.results, result{failed.pn, resp})
+		}
+	}
+
+	// The lock is held throughout, so don't let a stalled
+	// reconnection hold up everyone else for long.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*TimeoutSeconds)
+	written, err := c.write(ctx, after)
+	cancel()
+	for _, s := range after[written:] {
+		c.addResult(s.pn, err)
+	}
+	c.flush()
+}
+
+// confirm periodically treats notifications that have been written
+// for longer than TimeoutSeconds without a complaint from Apple as
+// accepted, until the session is done.
+func (c *Connection) confirm(sent *sentBuffer, done <-chan struct{}) {
+	timeout := time.Second * TimeoutSeconds
+	ticker := time.NewTicker(timeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			c.mu.Lock()
+			for _, s := range sent.confirm(now.Add(-timeout)) {
+				c.addResult(s.pn, nil)
+			}
+			c.flush()
+		}
+	}
+}
+
+// addResult records what became of a notification, to be reported
+// once the lock is released. The caller must hold c.mu.
+func (c *Connection) addResult(pn *PushNotification, err error) {
+	resp := new(PushNotificationResponse)
+	resp.Success = err == nil
+	resp.Identifier = pn.Identifier
+	resp.Error = err
+	c.results = append(c.results, result{pn, resp})
+}
+
+// flush releases c.mu and reports any recorded results. They're
+// reported without holding the lock so that handlers and readers
+// of the results channel are free to send notifications of their own.
+func (c *Connection) flush() {
+	results := c.results
+	c.results = nil
+	reconnects := c.reconnects
+	c.reconnects = nil
+	if c.idle != nil && (c.conn == nil || c.sent.pending == 0) {
+		close(c.idle)
+		c.idle = nil
+	}
+	c.mu.Unlock()
+
+	c.report(results)
+	if c.client.ReconnectHandler != nil {
+		for _, cause := range reconnects {
+			c.client.ReconnectHandler(cause)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendRejected(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[1] = 8
+
+	resp := g.client().Send(mockNotification(1))
+	if resp.Success {
+		t.Fatal("expected the notification to be rejected")
+	}
+	if resp.AppleResponse != "INVALID_TOKEN" {
+		t.Error("expected INVALID_TOKEN; got", resp.AppleResponse)
+	}
+	if resp.StatusCode != 8 || resp.Identifier != 1 || !errors.Is(resp.Error, ErrInvalidToken) {
+		t.Error("expected an ErrInvalidToken response for notification 1; got", resp.StatusCode, resp.Identifier, resp.Error)
+	}
+}
+
+func TestSendClosedWithoutResponse(t *testing.T) {
+	g := newMockGateway(t)
+	g.hangUp[1] = true
+
+	resp := g.client().Send(mockNotification(1))
+	if resp.Success || resp.Error != ErrClosedWithoutResponse {
+		t.Error("expected ErrClosedWithoutResponse; got", resp.Error)
+	}
+	if len(resp.AppleResponse) > 0 {
+		t.Error("expected no response from Apple; got", resp.AppleResponse)
+	}
+}
+
+func TestPersistentReusesConnection(t *testing.T) {
+	g := newMockGateway(t)
+
+	client := g.client()
+	client.Persistent = true
+	defer client.Close()
+
+	for i := int32(1); i <= 3; i++ {
+		if resp := client.Send(mockNotification(i)); !resp.Success {
+			t.Fatal("expected notification", i, "to be written; got", resp.Error)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for g.receivedCount(3) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected all 3 notifications to arrive")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g.dialCount() != 1 {
+		t.Error("expected a single connection; got", g.dialCount(), "dials")
+	}
+}
+
+func TestPersistentResendsAfterRejection(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[3] = 8
+
+	failed := make(chan *PushNotificationResponse, 5)
+	client := g.client()
+	client.Persistent = true
+	client.ErrorHandler = func(pn *PushNotification, resp *PushNotificationResponse) {
+		failed <- resp
+	}
+	defer client.Close()
+
+	for i := int32(1); i <= 5; i++ {
+		if resp := client.Send(mockNotification(i)); !resp.Success {
+			t.Fatal("expected notification", i, "to be written; got", resp.Error)
+		}
+	}
+
+	select {
+	case resp := <-failed:
+		if resp.Identifier != 3 || resp.AppleResponse != "INVALID_TOKEN" {
+			t.Error("expected notification 3 to be rejected; got", resp.Identifier, resp.AppleResponse)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the rejection to be reported")
+	}
+
+	// Everything after the rejected notification should
+	// eventually arrive on a fresh connection.
+	deadline := time.Now().Add(time.Second)
+	for g.receivedCount(4) == 0 || g.receivedCount(5) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected notifications 4 and 5 to be resent")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g.receivedCount(3) != 1 {
+		t.Error("expected the rejected notification not to be resent")
+	}
+	if g.dialCount() < 2 {
+		t.Error("expected a reconnection; got", g.dialCount(), "dials")
+	}
+}
+
+func TestResendHasDeadline(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[1] = 8
+
+	deadlines := make(chan bool, 4)
+	client := g.client()
+	client.Persistent = true
+	client.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		_, ok := ctx.Deadline()
+		deadlines <- ok
+		return g.dial(ctx, network, address)
+	}
+	defer client.Close()
+
+	resps := client.SendBatch([]*PushNotification{mockNotification(1), mockNotification(2)})
+	if !resps[0].Success || !resps[1].Success {
+		t.Fatal("expected both notifications to be written; got", resps[0].Error, resps[1].Error)
+	}
+	<-deadlines
+
+	select {
+	case ok := <-deadlines:
+		if !ok {
+			t.Error("expected the reconnection to resend notification 2 to have a deadline")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected notification 2 to be resent")
+	}
+}
+
+func TestIdleReconnect(t *testing.T) {
+	g := newMockGateway(t)
+
+	causes := make(chan error, 2)
+	client := g.client()
+	client.Persistent = true
+	client.IdleTimeout = 20 * time.Millisecond
+	client.ReconnectHandler = func(cause error) {
+		causes <- cause
+	}
+	defer client.Close()
+
+	if resp := client.Send(mockNotification(1)); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if resp := client.Send(mockNotification(2)); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+
+	if g.dialCount() != 2 {
+		t.Error("expected the idle session to be replaced; got", g.dialCount(), "dials")
+	}
+	select {
+	case cause := <-causes:
+		if cause != ErrIdleTimeout {
+			t.Error("expected ErrIdleTimeout; got", cause)
+		}
+	default:
+		t.Error("expected the reconnection to be reported")
+	}
+}
+
+func TestReconnectAfterHangUp(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[1] = 8
+
+	causes := make(chan error, 2)
+	client := g.client()
+	client.Persistent = true
+	client.ReconnectHandler = func(cause error) {
+		causes <- cause
+	}
+	defer client.Close()
+
+	if resp := client.Send(mockNotification(1)); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+
+	// Wait for the monitor to notice Apple hang up.
+	conn := client.Pool().conns[0]
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn.mu.Lock()
+		ended := conn.conn == nil
+		conn.mu.Unlock()
+		if ended {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the session to end")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if resp := client.Send(mockNotification(2)); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+	select {
+	case cause := <-causes:
+		if cause == nil || cause.Error() != "INVALID_TOKEN" {
+			t.Error("expected the rejection as the cause; got", cause)
+		}
+	default:
+		t.Error("expected the reconnection to be reported")
+	}
+}
@@ -0,0 +1,229 @@
+package apns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// The largest frame a valid notification can produce: a header
+// for each of the five items, plus the items themselves.
+const maxFrameLength = 5*3 + deviceTokenLength + MaxPayloadSizeBytes +
+	notificationIdentifierLength + expirationDateLength + priorityLength
+
+// FrameError describes a malformed notification read by a Decoder.
+// Item is the ID of the frame item at fault, or zero if the problem
+// isn't with any one item.
+type FrameError struct {
+	Command uint8
+	Item    uint8
+	Reason  string
+}
+
+func (e *FrameError) Error() string {
+	where := "command " + strconv.Itoa(int(e.Command))
+	if e.Item != 0 {
+		where += " item " + strconv.Itoa(int(e.Item))
+	}
+	return "malformed notification (" + where + "): " + e.Reason
+}
+
+// Decoder reads notifications written in any of the binary formats,
+// as produced by ToBytes and Encode, from a stream.
+type Decoder struct {
+	r      io.Reader
+	format Format
+}
+
+// NewDecoder returns a Decoder that reads from r. Reads aren't
+// buffered, so wrap r in a bufio.Reader if it's expensive to read.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads the next notification from the stream. Notifications
+// in the simple and enhanced formats, which have no priority, are
+// given priority 10 as Apple would.
+//
+// Decode returns io.EOF once the stream ends between notifications,
+// io.ErrUnexpectedEOF if it ends part-way through one, and a
+// *FrameError if a notification is malformed, after which there's
+// no telling where the next one starts.
+func (d *Decoder) Decode() (pn *PushNotification, err error) {
+	command, err := d.read(1)
+	if err != nil {
+		return nil, err
+	}
+
+	pn = new(PushNotification)
+	pn.Priority = 10
+	switch command[0] {
+	case simpleCommandValue:
+		d.format = SimpleFormat
+		err = d.decodeTokenAndPayload(pn, command[0])
+	case enhancedCommandValue:
+		d.format = EnhancedFormat
+		var header []byte
+		header, err = d.read(notificationIdentifierLength + expirationDateLength)
+		if err == nil {
+			pn.Identifier = int32(binary.BigEndian.Uint32(header[0:4]))
+			pn.Expiry = binary.BigEndian.Uint32(header[4:8])
+			err = d.decodeTokenAndPayload(pn, command[0])
+		}
+	case pushCommandValue:
+		d.format = FrameFormat
+		err = d.decodeFrame(pn)
+	default:
+		err = &FrameError{Command: command[0], Reason: "unknown command"}
+	}
+
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pn, nil
+}
+
+// Format returns the format of the notification last decoded.
+func (d *Decoder) Format() Format {
+	return d.format
+}
+
+func (d *Decoder) read(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
+
+// decodeTokenAndPayload reads the length-prefixed device token
+// and payload that end the simple and enhanced formats.
+func (d *Decoder) decodeTokenAndPayload(pn *PushNotification, command uint8) error {
+	length, err := d.read(2)
+	if err != nil {
+		return err
+	}
+	if n := int(binary.BigEndian.Uint16(length)); n != deviceTokenLength {
+		return &FrameError{Command: command, Reason: wrongLength("device token", deviceTokenLength, n)}
+	}
+	token, err := d.read(deviceTokenLength)
+	if err != nil {
+		return err
+	}
+	pn.DeviceToken = hex.EncodeToString(token)
+
+	length, err = d.read(2)
+	if err != nil {
+		return err
+	}
+	n := int(binary.BigEndian.Uint16(length))
+	if n > MaxPayloadSizeBytes {
+		return &FrameError{Command: command, Reason: tooLong(n)}
+	}
+	payload, err := d.read(n)
+	if err != nil {
+		return err
+	}
+	return decodePayload(pn, payload, command, 0)
+}
+
+// decodeFrame reads the items of a command 2 frame.
+func (d *Decoder) decodeFrame(pn *PushNotification) error {
+	header, err := d.read(4)
+	if err != nil {
+		return err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length > maxFrameLength {
+		return &FrameError{Command: pushCommandValue, Reason: "frame length " + strconv.FormatUint(uint64(length), 10) +
+			" exceeds the " + strconv.Itoa(maxFrameLength) + " byte limit"}
+	}
+	frame, err := d.read(int(length))
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[uint8]bool)
+	for len(frame) > 0 {
+		if len(frame) < 3 {
+			return &FrameError{Command: pushCommandValue, Reason: "frame ends part-way through an item header"}
+		}
+		id := frame[0]
+		n := int(binary.BigEndian.Uint16(frame[1:3]))
+		frame = frame[3:]
+		if n > len(frame) {
+			return &FrameError{Command: pushCommandValue, Item: id, Reason: "item length " + strconv.Itoa(n) + " overruns the frame"}
+		}
+		data := frame[:n]
+		frame = frame[n:]
+
+		if seen[id] {
+			return &FrameError{Command: pushCommandValue, Item: id, Reason: "item appears more than once"}
+		}
+		seen[id] = true
+
+		switch id {
+		case deviceTokenItemid:
+			if n != deviceTokenLength {
+				return &FrameError{Command: pushCommandValue, Item: id, Reason: wrongLength("device token", deviceTokenLength, n)}
+			}
+			pn.DeviceToken = hex.EncodeToString(data)
+		case payloadItemid:
+			if n > MaxPayloadSizeBytes {
+				return &FrameError{Command: pushCommandValue, Item: id, Reason: tooLong(n)}
+			}
+			if err := decodePayload(pn, data, pushCommandValue, id); err != nil {
+				return err
+			}
+		case notificationIdentifierItemid:
+			if n != notificationIdentifierLength {
+				return &FrameError{Command: pushCommandValue, Item: id, Reason: wrongLength("identifier", notificationIdentifierLength, n)}
+			}
+			pn.Identifier = int32(binary.BigEndian.Uint32(data))
+		case expirationDateItemid:
+			if n != expirationDateLength {
+				return &FrameError{Command: pushCommandValue, Item: id, Reason: wrongLength("expiration date", expirationDateLength, n)}
+			}
+			pn.Expiry = binary.BigEndian.Uint32(data)
+		case priorityItemid:
+			if n != priorityLength {
+				return &FrameError{Command: pushCommandValue, Item: id, Reason: wrongLength("priority", priorityLength, n)}
+			}
+			pn.Priority = data[0]
+		default:
+			return &FrameError{Command: pushCommandValue, Item: id, Reason: "unknown item"}
+		}
+	}
+
+	if !seen[deviceTokenItemid] {
+		return &FrameError{Command: pushCommandValue, Item: deviceTokenItemid, Reason: "missing device token"}
+	}
+	if !seen[payloadItemid] {
+		return &FrameError{Command: pushCommandValue, Item: payloadItemid, Reason: "missing payload"}
+	}
+	return nil
+}
+
+// decodePayload parses the JSON payload into the notification.
+// Numbers are kept as json.Number so that they're written back
+// exactly as they were.
+func decodePayload(pn *PushNotification, payload []byte, command, item uint8) error {
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&pn.payload); err != nil || pn.payload == nil || decoder.More() {
+		return &FrameError{Command: command, Item: item, Reason: "payload is not a JSON object"}
+	}
+	return nil
+}
+
+func wrongLength(what string, want, got int) string {
+	return what + " must be " + strconv.Itoa(want) + " bytes; got " + strconv.Itoa(got)
+}
+
+func tooLong(n int) string {
+	return "payload of " + strconv.Itoa(n) + " bytes exceeds the " + strconv.Itoa(MaxPayloadSizeBytes) + " byte limit"
+}
@@ -0,0 +1,149 @@
+package apns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func TestDecodeFormats(t *testing.T) {
+	pn := mockNotification(1234)
+	pn.Expiry = 1700000000
+	pn.Priority = 5
+	want, _ := pn.PayloadString()
+
+	for _, format := range []Format{FrameFormat, EnhancedFormat, SimpleFormat} {
+		data, err := pn.Encode(format)
+		if err != nil {
+			t.Fatal(format, err)
+		}
+
+		d := NewDecoder(bytes.NewReader(data))
+		decoded, err := d.Decode()
+		if err != nil {
+			t.Fatal(format, err)
+		}
+		if d.Format() != format {
+			t.Error("expected", format, "format; got", d.Format())
+		}
+		if decoded.DeviceToken != testDeviceToken {
+			t.Error(format, "expected the device token to survive; got", decoded.DeviceToken)
+		}
+		if got, _ := decoded.PayloadString(); got != want {
+			t.Error(format, "expected payload", want, "; got", got)
+		}
+		if _, err := d.Decode(); err != io.EOF {
+			t.Error(format, "expected io.EOF at the end; got", err)
+		}
+
+		switch format {
+		case FrameFormat:
+			if decoded.Identifier != 1234 || decoded.Expiry != 1700000000 || decoded.Priority != 5 {
+				t.Error("expected the frame's items to survive; got", decoded.Identifier, decoded.Expiry, decoded.Priority)
+			}
+		case EnhancedFormat:
+			if decoded.Identifier != 1234 || decoded.Expiry != 1700000000 || decoded.Priority != 10 {
+				t.Error("expected the identifier and expiry to survive; got", decoded.Identifier, decoded.Expiry, decoded.Priority)
+			}
+		}
+	}
+}
+
+func TestDecodeAnyPriority(t *testing.T) {
+	// Whatever ToBytes writes must decode.
+	pn := mockNotification(1)
+	pn.Priority = 0
+	data, err := pn.ToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := NewDecoder(bytes.NewReader(data)).Decode()
+	if err != nil {
+		t.Fatal("expected priority 0 to decode; got", err)
+	}
+	if decoded.Priority != 0 {
+		t.Error("expected priority 0; got", decoded.Priority)
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	var stream []byte
+	for i := int32(1); i <= 3; i++ {
+		data, _ := mockNotification(i).ToBytes()
+		stream = append(stream, data...)
+	}
+
+	d := NewDecoder(bytes.NewReader(stream))
+	for i := int32(1); i <= 3; i++ {
+		pn, err := d.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pn.Identifier != i {
+			t.Error("expected notification", i, "; got", pn.Identifier)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	data, _ := mockNotification(1).ToBytes()
+	for _, n := range []int{1, 4, 20, len(data) - 1} {
+		_, err := NewDecoder(bytes.NewReader(data[:n])).Decode()
+		if err != io.ErrUnexpectedEOF {
+			t.Error("expected io.ErrUnexpectedEOF for", n, "bytes; got", err)
+		}
+	}
+}
+
+// mockFrame builds a command 2 frame from raw items.
+func mockFrame(items ...[]byte) []byte {
+	var body []byte
+	for _, item := range items {
+		body = append(body, item...)
+	}
+	data := []byte{pushCommandValue}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(body)))
+	return append(data, body...)
+}
+
+func mockItem(id uint8, data []byte) []byte {
+	b := []byte{id}
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+	return append(b, data...)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	token := mockItem(deviceTokenItemid, make([]byte, deviceTokenLength))
+	payload := mockItem(payloadItemid, []byte(`{"aps":{}}`))
+
+	tests := []struct {
+		name string
+		data []byte
+		item uint8
+	}{
+		{"unknown command", []byte{7}, 0},
+		{"short token", mockFrame(mockItem(deviceTokenItemid, make([]byte, 31)), payload), deviceTokenItemid},
+		{"missing token", mockFrame(payload), deviceTokenItemid},
+		{"missing payload", mockFrame(token), payloadItemid},
+		{"repeated item", mockFrame(token, token, payload), deviceTokenItemid},
+		{"unknown item", mockFrame(token, payload, mockItem(9, nil)), 9},
+		{"bad identifier", mockFrame(token, payload, mockItem(notificationIdentifierItemid, []byte{1, 2})), notificationIdentifierItemid},
+		{"bad priority", mockFrame(token, payload, mockItem(priorityItemid, []byte{0, 10})), priorityItemid},
+		{"invalid JSON", mockFrame(token, mockItem(payloadItemid, []byte(`{"aps"`))), payloadItemid},
+		{"not an object", mockFrame(token, mockItem(payloadItemid, []byte(`[1]`))), payloadItemid},
+		{"overrun", mockFrame(token, []byte{payloadItemid, 0, 200, '{', '}'}), payloadItemid},
+		{"oversized frame", []byte{pushCommandValue, 0, 1, 0, 0}, 0},
+	}
+	for _, test := range tests {
+		_, err := NewDecoder(bytes.NewReader(test.data)).Decode()
+		frameErr, ok := err.(*FrameError)
+		if !ok {
+			t.Error(test.name, "- expected a FrameError; got", err)
+			continue
+		}
+		if frameErr.Item != test.item {
+			t.Error(test.name, "- expected item", test.item, "; got", frameErr.Item, frameErr)
+		}
+	}
+}
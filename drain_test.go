@@ -0,0 +1,134 @@
+package apns
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDrain(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[3] = 8
+
+	client := g.client()
+	results := client.Results()
+	for i := int32(1); i <= 3; i++ {
+		if err := client.Enqueue(mockNotification(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Apple's rejection settles the fate of everything,
+	// so there's no need to wait out the grace period.
+	start := time.Now()
+	if err := client.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("expected Drain to finish once everything was settled; took", elapsed)
+	}
+
+	outcomes := make(map[int32]bool)
+	for len(outcomes) < 3 {
+		select {
+		case resp := <-results:
+			outcomes[resp.Identifier] = resp.Success
+		default:
+			t.Fatal("expected results for all 3 notifications before Drain returned; got", outcomes)
+		}
+	}
+	if !outcomes[1] || !outcomes[2] || outcomes[3] {
+		t.Error("expected 1 and 2 to be accepted and 3 rejected; got", outcomes)
+	}
+}
+
+func TestDrainUnconfirmed(t *testing.T) {
+	g := newMockGateway(t)
+
+	client := g.client()
+	client.GracePeriod = 50 * time.Millisecond
+	results := client.Results()
+	if err := client.Enqueue(mockNotification(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.Drain(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case resp := <-results:
+		if resp.Success || resp.Error != ErrUnconfirmed {
+			t.Error("expected ErrUnconfirmed; got", resp.Error)
+		}
+	default:
+		t.Fatal("expected the notification to be reported")
+	}
+}
+
+func TestDrainStopsAccepting(t *testing.T) {
+	g := newMockGateway(t)
+
+	client := g.client()
+	client.Persistent = true
+	if resp := client.Send(mockNotification(1)); !resp.Success {
+		t.Fatal(resp.Error)
+	}
+
+	pool := client.Pool()
+	ctx, cancel := context.WithCancel(context.Background())
+	drained := make(chan error)
+	go func() { drained <- client.Drain(ctx) }()
+
+	deadline := time.Now().Add(time.Second)
+	for pool.Size() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the pool to start draining")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := client.Enqueue(mockNotification(2)); err != ErrConnectionClosed {
+		t.Error("expected ErrConnectionClosed while draining; got", err)
+	}
+
+	cancel()
+	if err := <-drained; err != context.Canceled {
+		t.Error("expected context.Canceled; got", err)
+	}
+}
+
+func TestDrainResultsUnread(t *testing.T) {
+	g := newMockGateway(t)
+
+	client := g.client()
+	client.Persistent = true
+	client.QueueSize = 1
+	client.GracePeriod = 10 * time.Millisecond
+	results := client.Results()
+
+	// Nobody reads the results until Drain returns, and there
+	// are more of them than the channel holds.
+	for i := int32(1); i <= 3; i++ {
+		if resp := client.Send(mockNotification(i)); !resp.Success {
+			t.Fatal(resp.Error)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := client.Drain(ctx); err != context.DeadlineExceeded {
+		t.Error("expected context.DeadlineExceeded; got", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Error("expected Drain to give up at the deadline; took", elapsed)
+	}
+
+	// The rest are still delivered once somebody reads them.
+	for i := 0; i < 3; i++ {
+		select {
+		case <-results:
+		case <-time.After(time.Second):
+			t.Fatal("expected results for all 3 notifications; got", i)
+		}
+	}
+}
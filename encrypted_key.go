@@ -0,0 +1,207 @@
+package apns
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// ErrIncorrectPassphrase is returned when an encrypted private
+// key can't be decrypted with the passphrase provided.
+var ErrIncorrectPassphrase = errors.New("incorrect passphrase for encrypted private key")
+
+// Object identifiers for the parts of PKCS#5 v2.0 (RFC 8018)
+// used to encrypt PKCS#8 private keys.
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// hasPassphrase reports whether the client has been given
+// a way of decrypting its private key.
+func (client *Client) hasPassphrase() bool {
+	return client.KeyPassphraseFunc != nil || len(client.KeyPassphrase) > 0
+}
+
+// passphrase returns the passphrase for the client's private key,
+// preferring KeyPassphraseFunc to KeyPassphrase.
+func (client *Client) passphrase() ([]byte, error) {
+	if client.KeyPassphraseFunc != nil {
+		return client.KeyPassphraseFunc()
+	}
+	return []byte(client.KeyPassphrase), nil
+}
+
+// readKeyPair returns the PEM encoded certificate and key,
+// from the filesystem or the raw block fields as appropriate.
+func (client *Client) readKeyPair() (certPEM, keyPEM []byte, err error) {
+	if len(client.CertificateBase64) == 0 && len(client.KeyBase64) == 0 {
+		certPEM, err = os.ReadFile(client.CertificateFile)
+		if err != nil {
+			return
+		}
+		keyPEM, err = os.ReadFile(client.KeyFile)
+		return
+	}
+	return []byte(client.CertificateBase64), []byte(client.KeyBase64), nil
+}
+
+// decryptPEMKey decrypts the first private key in keyPEM, which may
+// be an encrypted PKCS#8 key ("ENCRYPTED PRIVATE KEY") or a legacy
+// OpenSSL key with a "Proc-Type: 4,ENCRYPTED" header, returning it
+// PEM encoded. Keys that aren't encrypted are returned as they are.
+func decryptPEMKey(keyPEM, passphrase []byte) ([]byte, error) {
+	rest := keyPEM
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, errors.New("failed to find a private key in PEM data")
+		}
+
+		switch {
+		case block.Type == "ENCRYPTED PRIVATE KEY":
+			der, err := decryptPKCS8(block.Bytes, passphrase)
+			if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+
+		case x509.IsEncryptedPEMBlock(block):
+			der, err := x509.DecryptPEMBlock(block, passphrase)
+			if err == x509.IncorrectPasswordError {
+				return nil, ErrIncorrectPassphrase
+			}
+			if err != nil {
+				return nil, err
+			}
+			return pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: der}), nil
+
+		case strings.HasSuffix(block.Type, "PRIVATE KEY"):
+			return pem.EncodeToMemory(block), nil
+		}
+	}
+}
+
+// decryptPKCS8 decrypts a PBES2 encrypted PKCS#8 key, as produced
+// by "openssl pkcs8 -topk8" and most other modern tools.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported private key encryption; only PBES2 is supported")
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("unsupported private key derivation; only PBKDF2 is supported")
+	}
+
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, err
+	}
+
+	var prf func() hash.Hash
+	switch {
+	case len(kdf.PRF.Algorithm) == 0, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("unsupported PBKDF2 pseudo-random function")
+	}
+
+	var keyLength int
+	var newCipher func(key []byte) (cipher.Block, error)
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case scheme.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case scheme.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case scheme.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.New("unsupported private key cipher")
+	}
+
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	key := pbkdf2.Key(passphrase, kdf.Salt, kdf.IterationCount, keyLength, prf)
+	block, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != block.BlockSize() || len(info.EncryptedData) == 0 || len(info.EncryptedData)%block.BlockSize() != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+
+	plain := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, info.EncryptedData)
+
+	// A wrong passphrase almost always shows up as bad padding;
+	// failing that, the result won't parse as a key.
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, ErrIncorrectPassphrase
+	}
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, ErrIncorrectPassphrase
+		}
+	}
+	plain = plain[:len(plain)-pad]
+	if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plain, nil
+}
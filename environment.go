@@ -0,0 +1,88 @@
+package apns
+
+// Environment describes where to find Apple's services for one of
+// its environments: the binary push gateway, the feedback service and
+// the HTTP/2 provider API. Apple also serves the provider API on port
+// 2197 for networks that block outgoing connections on 443.
+type Environment struct {
+	Name     string
+	Gateway  string
+	Feedback string
+	HTTP2    string
+}
+
+// Apple's development and production environments.
+var (
+	Sandbox = &Environment{
+		Name:     "sandbox",
+		Gateway:  "gateway.sandbox.push.apple.com:2195",
+		Feedback: "feedback.sandbox.push.apple.com:2196",
+		HTTP2:    "api.sandbox.push.apple.com:443",
+	}
+	Production = &Environment{
+		Name:     "production",
+		Gateway:  "gateway.push.apple.com:2195",
+		Feedback: "feedback.push.apple.com:2196",
+		HTTP2:    "api.push.apple.com:443",
+	}
+)
+
+// CustomEnvironment describes an environment of your own, such as
+// a test double or an APNs-compatible relay.
+func CustomEnvironment(name, gateway, feedback, http2 string) *Environment {
+	return &Environment{
+		Name:     name,
+		Gateway:  gateway,
+		Feedback: feedback,
+		HTTP2:    http2,
+	}
+}
+
+// NewEnvironmentClient is like NewClient, but takes the gateway
+// and feedback service addresses from the given environment.
+func NewEnvironmentClient(env *Environment, certificateFile, keyFile string) (c *Client) {
+	c = NewClient(env.Gateway, certificateFile, keyFile)
+	c.Environment = env
+	return
+}
+
+// gateway returns the address of the binary push gateway.
+func (client *Client) gateway() string {
+	if len(client.Gateway) == 0 && client.Environment != nil {
+		return client.Environment.Gateway
+	}
+	return client.Gateway
+}
+
+// feedbackGateway returns the address of the feedback service. Without
+// an Environment, it's derived from Gateway when that's one of Apple's
+// push gateways; otherwise Gateway is assumed to point at the feedback
+// service already, as it always used to.
+func (client *Client) feedbackGateway() string {
+	if client.Environment != nil && len(client.Environment.Feedback) > 0 {
+		return client.Environment.Feedback
+	}
+	gateway := client.gateway()
+	for _, env := range []*Environment{Sandbox, Production} {
+		if gateway == env.Gateway {
+			return env.Feedback
+		}
+	}
+	return gateway
+}
+
+// http2Address returns the address of the HTTP/2 provider API,
+// derived from Gateway, if need be, in the same way as the
+// feedback service's.
+func (client *Client) http2Address() string {
+	if client.Environment != nil && len(client.Environment.HTTP2) > 0 {
+		return client.Environment.HTTP2
+	}
+	gateway := client.gateway()
+	for _, env := range []*Environment{Sandbox, Production} {
+		if gateway == env.Gateway {
+			return env.HTTP2
+		}
+	}
+	return gateway
+}
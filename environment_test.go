@@ -0,0 +1,47 @@
+package apns
+
+import "testing"
+
+func TestEnvironmentAddresses(t *testing.T) {
+	tests := []struct {
+		client   *Client
+		gateway  string
+		feedback string
+	}{
+		{NewEnvironmentClient(Sandbox, "", ""), "gateway.sandbox.push.apple.com:2195", "feedback.sandbox.push.apple.com:2196"},
+		{NewEnvironmentClient(Production, "", ""), "gateway.push.apple.com:2195", "feedback.push.apple.com:2196"},
+		{&Client{Environment: Production}, "gateway.push.apple.com:2195", "feedback.push.apple.com:2196"},
+		{NewEnvironmentClient(CustomEnvironment("relay", "relay:2195", "relay:2196", ""), "", ""), "relay:2195", "relay:2196"},
+
+		// Without an environment, Apple's feedback service is
+		// derived from its gateway, and anything else left alone.
+		{NewClient("gateway.sandbox.push.apple.com:2195", "", ""), "gateway.sandbox.push.apple.com:2195", "feedback.sandbox.push.apple.com:2196"},
+		{NewClient("feedback.push.apple.com:2196", "", ""), "feedback.push.apple.com:2196", "feedback.push.apple.com:2196"},
+	}
+
+	for _, test := range tests {
+		if g := test.client.gateway(); g != test.gateway {
+			t.Error("expected gateway", test.gateway, "; got", g)
+		}
+		if f := test.client.feedbackGateway(); f != test.feedback {
+			t.Error("expected feedback service", test.feedback, "; got", f)
+		}
+	}
+}
+
+func TestHTTP2Address(t *testing.T) {
+	tests := []struct {
+		client *Client
+		http2  string
+	}{
+		{NewEnvironmentClient(Sandbox, "", ""), "api.sandbox.push.apple.com:443"},
+		{NewClient("gateway.push.apple.com:2195", "", ""), "api.push.apple.com:443"},
+		{NewClient("relay:443", "", ""), "relay:443"},
+	}
+
+	for _, test := range tests {
+		if a := test.client.http2Address(); a != test.http2 {
+			t.Error("expected provider API", test.http2, "; got", a)
+		}
+	}
+}
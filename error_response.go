@@ -0,0 +1,130 @@
+package apns
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Error responses always start with command value 8.
+const errorResponseCommand = 8
+
+// The length of an error response packet.
+const errorResponseLength = 6
+
+// These errors correspond to the status codes Apple sends in an
+// error response. An *ErrorResponse matches the one for its status
+// with errors.Is, so you can write
+//
+//	if errors.Is(resp.Error, apns.ErrInvalidToken) {
+//		// forget the device
+//	}
+var (
+	ErrProcessingError    = errors.New("PROCESSING_ERROR")
+	ErrMissingDeviceToken = errors.New("MISSING_DEVICE_TOKEN")
+	ErrMissingTopic       = errors.New("MISSING_TOPIC")
+	ErrMissingPayload     = errors.New("MISSING_PAYLOAD")
+	ErrInvalidTokenSize   = errors.New("INVALID_TOKEN_SIZE")
+	ErrInvalidTopicSize   = errors.New("INVALID_TOPIC_SIZE")
+	ErrInvalidPayloadSize = errors.New("INVALID_PAYLOAD_SIZE")
+	ErrInvalidToken       = errors.New("INVALID_TOKEN")
+	ErrShutdown           = errors.New("SHUTDOWN")
+	ErrUnknown            = errors.New("UNKNOWN")
+)
+
+// ErrClosedWithoutResponse is returned when Apple closes the connection
+// without sending an error response, leaving the fate of whatever was
+// written unknown.
+var ErrClosedWithoutResponse = errors.New("gateway closed the connection without an error response")
+
+// ErrTruncatedResponse is returned when the connection closes
+// part-way through an error response.
+var ErrTruncatedResponse = errors.New("gateway closed the connection part-way through an error response")
+
+var statusErrors = map[uint8]error{
+	1:   ErrProcessingError,
+	2:   ErrMissingDeviceToken,
+	3:   ErrMissingTopic,
+	4:   ErrMissingPayload,
+	5:   ErrInvalidTokenSize,
+	6:   ErrInvalidTopicSize,
+	7:   ErrInvalidPayloadSize,
+	8:   ErrInvalidToken,
+	10:  ErrShutdown,
+	255: ErrUnknown,
+}
+
+// ErrorResponse is the packet Apple sends just before closing the
+// connection when it rejects a notification. Identifier is that of
+// the rejected notification or, when shutting down, of the last one
+// Apple processed successfully.
+//
+// The data structure for an APN error response is as follows:
+//
+//	command    -> 1 byte
+//	status     -> 1 byte
+//	identifier -> 4 bytes
+type ErrorResponse struct {
+	Command    uint8
+	Status     uint8
+	Identifier int32
+}
+
+// DecodeErrorResponse parses an error response packet.
+func DecodeErrorResponse(packet []byte) (*ErrorResponse, error) {
+	if len(packet) != errorResponseLength {
+		return nil, errors.New("error response must be " + strconv.Itoa(errorResponseLength) + " bytes; got " + strconv.Itoa(len(packet)))
+	}
+	if packet[0] != errorResponseCommand {
+		return nil, errors.New("unexpected command " + strconv.Itoa(int(packet[0])) + " in error response")
+	}
+	e := new(ErrorResponse)
+	e.Command = packet[0]
+	e.Status = packet[1]
+	e.Identifier = int32(binary.BigEndian.Uint32(packet[2:6]))
+	return e, nil
+}
+
+// readErrorResponse waits for Apple to send an error response on the
+// connection. If Apple hangs up instead it returns ErrClosedWithoutResponse,
+// or ErrTruncatedResponse if it did so mid-response; any other error is
+// whatever went wrong with the connection itself.
+func readErrorResponse(r io.Reader) (*ErrorResponse, error) {
+	packet := make([]byte, errorResponseLength)
+	_, err := io.ReadFull(r, packet)
+	switch err {
+	case nil:
+		return DecodeErrorResponse(packet)
+	case io.EOF:
+		return nil, ErrClosedWithoutResponse
+	case io.ErrUnexpectedEOF:
+		return nil, ErrTruncatedResponse
+	}
+	return nil, err
+}
+
+// Error returns Apple's name for the status, as found in
+// ApplePushResponses, or says it's unknown.
+func (e *ErrorResponse) Error() string {
+	if name, ok := ApplePushResponses[e.Status]; ok {
+		return name
+	}
+	return "unknown status " + strconv.Itoa(int(e.Status))
+}
+
+// Is reports whether target is the error for the response's status.
+func (e *ErrorResponse) Is(target error) bool {
+	err, ok := statusErrors[e.Status]
+	return ok && err == target
+}
+
+// setErrorResponse records Apple's error response as the reason
+// the notification failed.
+func (resp *PushNotificationResponse) setErrorResponse(e *ErrorResponse) {
+	resp.Success = false
+	resp.Identifier = e.Identifier
+	resp.StatusCode = e.Status
+	resp.AppleResponse = e.Error()
+	resp.Error = e
+}
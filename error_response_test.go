@@ -0,0 +1,70 @@
+package apns
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestDecodeErrorResponse(t *testing.T) {
+	e, err := DecodeErrorResponse([]byte{8, 8, 0, 0, 4, 210})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Command != 8 || e.Status != 8 || e.Identifier != 1234 {
+		t.Error("expected command 8, status 8 and identifier 1234; got", e.Command, e.Status, e.Identifier)
+	}
+	if e.Error() != "INVALID_TOKEN" {
+		t.Error("expected INVALID_TOKEN; got", e.Error())
+	}
+	if !errors.Is(e, ErrInvalidToken) || errors.Is(e, ErrShutdown) {
+		t.Error("expected the response to match ErrInvalidToken alone")
+	}
+
+	if _, err := DecodeErrorResponse([]byte{8, 8, 0, 0}); err == nil {
+		t.Error("expected a short packet to be rejected")
+	}
+	if _, err := DecodeErrorResponse([]byte{2, 8, 0, 0, 0, 1}); err == nil {
+		t.Error("expected a packet with the wrong command to be rejected")
+	}
+}
+
+func TestUnknownStatus(t *testing.T) {
+	e := &ErrorResponse{Command: 8, Status: 42, Identifier: 1}
+	if e.Error() != "unknown status 42" {
+		t.Error("expected the status to be named; got", e.Error())
+	}
+	if errors.Is(e, ErrUnknown) {
+		t.Error("expected an unlisted status not to match any error")
+	}
+}
+
+type failingReader struct{ err error }
+
+func (r failingReader) Read(p []byte) (int, error) { return 0, r.err }
+
+func TestReadErrorResponse(t *testing.T) {
+	e, err := readErrorResponse(bytes.NewReader([]byte{8, 10, 0, 0, 0, 7}))
+	if err != nil || e.Status != 10 || e.Identifier != 7 {
+		t.Error("expected a SHUTDOWN response for 7; got", e, err)
+	}
+
+	if _, err := readErrorResponse(bytes.NewReader(nil)); err != ErrClosedWithoutResponse {
+		t.Error("expected ErrClosedWithoutResponse; got", err)
+	}
+	if _, err := readErrorResponse(bytes.NewReader([]byte{8, 8, 0})); err != ErrTruncatedResponse {
+		t.Error("expected ErrTruncatedResponse; got", err)
+	}
+
+	// A short read mustn't be mistaken for a whole response.
+	r := io.MultiReader(bytes.NewReader([]byte{8, 8}), bytes.NewReader([]byte{0, 0, 0, 9}))
+	if e, err := readErrorResponse(r); err != nil || e.Identifier != 9 {
+		t.Error("expected the response to be read in pieces; got", e, err)
+	}
+
+	reset := errors.New("connection reset by peer")
+	if _, err := readErrorResponse(failingReader{reset}); err != reset {
+		t.Error("expected the network error; got", err)
+	}
+}
@@ -2,12 +2,10 @@ package apns
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
-	"net"
-	"strings"
 	"time"
 )
 
@@ -34,44 +32,39 @@ func NewFeedbackResponse() (resp *FeedbackResponse) {
 }
 
 // ListenForFeedback connects to the Apple Feedback Service
-// and checks for device tokens.
+// and checks for device tokens. The service is found through the
+// client's Environment or, failing that, its Gateway.
 //
 // Feedback consists of device tokens that should
 // not be sent to in the future; Apple *does* monitor that
 // you respect this so you should be checking it ;)
 func (client *Client) ListenForFeedback() (err error) {
-	var cert tls.Certificate
-
-	if len(client.CertificateBase64) == 0 && len(client.KeyBase64) == 0 {
-		// The user did not specify raw block contents, so check the filesystem.
-		cert, err = tls.LoadX509KeyPair(client.CertificateFile, client.KeyFile)
-	} else {
-		// The user provided the raw block contents, so use that.
-		cert, err = tls.X509KeyPair([]byte(client.CertificateBase64), []byte(client.KeyBase64))
-	}
-
-	if err != nil {
-		return err
-	}
+	return client.ListenForFeedbackContext(context.Background())
+}
 
-	gatewayParts := strings.Split(client.Gateway, ":")
-	conf := &tls.Config{
-		Certificates: []tls.Certificate{cert},
-		ServerName:   gatewayParts[0],
+// ListenForFeedbackContext is like ListenForFeedback, but stops
+// listening once the context is cancelled or its deadline passes,
+// returning the context's error.
+func (client *Client) ListenForFeedbackContext(ctx context.Context) (err error) {
+	deadline := time.Now().Add(FeedbackTimeoutSeconds * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
 	}
 
-	conn, err := net.Dial("tcp", client.Gateway)
+	// The deadline covers dialing and the handshake too, so
+	// a feedback service that never answers can't hold us up.
+	dialCtx, cancel := context.WithDeadline(ctx, deadline)
+	tlsConn, err := client.dialContext(dialCtx, client.feedbackGateway())
+	cancel()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	conn.SetReadDeadline(time.Now().Add(FeedbackTimeoutSeconds * time.Second))
+	defer tlsConn.Close()
+	tlsConn.SetReadDeadline(deadline)
 
-	tlsConn := tls.Client(conn, conf)
-	err = tlsConn.Handshake()
-	if err != nil {
-		return err
-	}
+	// Closing the connection unblocks any pending read.
+	stop := context.AfterFunc(ctx, func() { tlsConn.Close() })
+	defer stop()
 
 	var tokenLength uint16
 	buffer := make([]byte, 38, 38)
@@ -80,7 +73,14 @@ func (client *Client) ListenForFeedback() (err error) {
 	for {
 		_, err := tlsConn.Read(buffer)
 		if err != nil {
-			ShutdownChannel <- true
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case ShutdownChannel <- true:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
 			break
 		}
 
@@ -95,7 +95,11 @@ func (client *Client) ListenForFeedback() (err error) {
 		}
 		resp.DeviceToken = hex.EncodeToString(deviceToken)
 
-		FeedbackChannel <- resp
+		select {
+		case FeedbackChannel <- resp:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
 	return nil
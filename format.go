@@ -0,0 +1,105 @@
+package apns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// The commands that introduce the older notification formats.
+const (
+	simpleCommandValue   = 0
+	enhancedCommandValue = 1
+)
+
+// Format is one of the binary formats a notification can be
+// written to the gateway in.
+//
+// Apple's gateways understand all three, but only the frame format
+// carries a priority, and the simple format has no identifier for
+// Apple to report a rejection against: it just hangs up. The older
+// formats are mostly of use with relays and third-party gateways
+// that never learned the newer ones.
+type Format int
+
+const (
+	// FrameFormat is command 2, the current format, and the default.
+	FrameFormat Format = iota
+
+	// EnhancedFormat is command 1, with an identifier and expiry.
+	EnhancedFormat
+
+	// SimpleFormat is command 0, with just a device token and payload.
+	SimpleFormat
+)
+
+func (f Format) String() string {
+	switch f {
+	case FrameFormat:
+		return "frame"
+	case EnhancedFormat:
+		return "enhanced"
+	case SimpleFormat:
+		return "simple"
+	}
+	return "unknown"
+}
+
+// Encode returns the PushNotification in the given binary format,
+// ready to be transmitted to the APN service.
+func (pn *PushNotification) Encode(format Format) ([]byte, error) {
+	token, payload, err := pn.tokenAndPayload()
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := new(bytes.Buffer)
+	switch format {
+	case FrameFormat:
+		frameBuffer := new(bytes.Buffer)
+		binary.Write(frameBuffer, binary.BigEndian, uint8(deviceTokenItemid))
+		binary.Write(frameBuffer, binary.BigEndian, uint16(deviceTokenLength))
+		binary.Write(frameBuffer, binary.BigEndian, token)
+		binary.Write(frameBuffer, binary.BigEndian, uint8(payloadItemid))
+		binary.Write(frameBuffer, binary.BigEndian, uint16(len(payload)))
+		binary.Write(frameBuffer, binary.BigEndian, payload)
+		binary.Write(frameBuffer, binary.BigEndian, uint8(notificationIdentifierItemid))
+		binary.Write(frameBuffer, binary.BigEndian, uint16(notificationIdentifierLength))
+		binary.Write(frameBuffer, binary.BigEndian, pn.Identifier)
+		binary.Write(frameBuffer, binary.BigEndian, uint8(expirationDateItemid))
+		binary.Write(frameBuffer, binary.BigEndian, uint16(expirationDateLength))
+		binary.Write(frameBuffer, binary.BigEndian, pn.Expiry)
+		binary.Write(frameBuffer, binary.BigEndian, uint8(priorityItemid))
+		binary.Write(frameBuffer, binary.BigEndian, uint16(priorityLength))
+		binary.Write(frameBuffer, binary.BigEndian, pn.Priority)
+
+		binary.Write(buffer, binary.BigEndian, uint8(pushCommandValue))
+		binary.Write(buffer, binary.BigEndian, uint32(frameBuffer.Len()))
+		binary.Write(buffer, binary.BigEndian, frameBuffer.Bytes())
+
+	case EnhancedFormat:
+		binary.Write(buffer, binary.BigEndian, uint8(enhancedCommandValue))
+		binary.Write(buffer, binary.BigEndian, pn.Identifier)
+		binary.Write(buffer, binary.BigEndian, pn.Expiry)
+		binary.Write(buffer, binary.BigEndian, uint16(deviceTokenLength))
+		binary.Write(buffer, binary.BigEndian, token)
+		binary.Write(buffer, binary.BigEndian, uint16(len(payload)))
+		binary.Write(buffer, binary.BigEndian, payload)
+
+	case SimpleFormat:
+		binary.Write(buffer, binary.BigEndian, uint8(simpleCommandValue))
+		binary.Write(buffer, binary.BigEndian, uint16(deviceTokenLength))
+		binary.Write(buffer, binary.BigEndian, token)
+		binary.Write(buffer, binary.BigEndian, uint16(len(payload)))
+		binary.Write(buffer, binary.BigEndian, payload)
+
+	default:
+		return nil, errors.New("unknown notification format")
+	}
+	return buffer.Bytes(), nil
+}
+
+// encode returns the notification in the client's format.
+func (client *Client) encode(pn *PushNotification) ([]byte, error) {
+	return pn.Encode(client.Format)
+}
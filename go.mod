@@ -0,0 +1,16 @@
+module github.com/anachronistic/apns
+
+go 1.21
+
+require (
+	github.com/stretchr/testify v1.9.0
+	golang.org/x/crypto v0.11.0
+	software.sslmate.com/src/go-pkcs12 v0.5.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/objx v0.5.2 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
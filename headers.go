@@ -0,0 +1,156 @@
+package apns
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The longest apns-collapse-id Apple accepts.
+const MaxCollapseIDBytes = 64
+
+// PushType says what kind of notification is being sent, as the
+// provider API's apns-push-type header requires.
+type PushType string
+
+// The push types Apple knows about.
+const (
+	PushTypeAlert        PushType = "alert"
+	PushTypeBackground   PushType = "background"
+	PushTypeVoIP         PushType = "voip"
+	PushTypeComplication PushType = "complication"
+	PushTypeFileProvider PushType = "fileprovider"
+	PushTypeMDM          PushType = "mdm"
+	PushTypeLocation     PushType = "location"
+	PushTypeLiveActivity PushType = "liveactivity"
+	PushTypePushToTalk   PushType = "pushtotalk"
+	PushTypeWidgets      PushType = "widgets"
+)
+
+// Most push types must be sent to a topic made by adding
+// a suffix to the app's bundle ID.
+var topicSuffixes = map[PushType]string{
+	PushTypeAlert:        "",
+	PushTypeBackground:   "",
+	PushTypeVoIP:         ".voip",
+	PushTypeComplication: ".complication",
+	PushTypeFileProvider: ".pushkit.fileprovider",
+	PushTypeMDM:          "",
+	PushTypeLocation:     ".location-query",
+	PushTypeLiveActivity: ".push-type.liveactivity",
+	PushTypePushToTalk:   ".voip-ptt",
+	PushTypeWidgets:      ".push-type.widgets",
+}
+
+// headers returns the apns-* headers for sending the notification
+// through the provider API, checking them against Apple's rules and
+// filling in any that are missing:
+//
+// PushType defaults to background for notifications that only set
+// content-available, and alert for anything else. Background
+// notifications are always sent with priority 5, as Apple insists,
+// unless Priority has been lowered even further. A Priority of 0 isn't
+// one Apple accepts, so the header is left out and Apple's default of
+// 10 applies.
+//
+// Topic defaults to the given one, usually the app's bundle ID, with
+// whatever suffix the push type calls for. ApnsID defaults to a UUID
+// made from Identifier.
+func (pn *PushNotification) headers(defaultTopic string) (http.Header, error) {
+	pushType := pn.PushType
+	if len(pushType) == 0 {
+		pushType = pn.defaultPushType()
+	}
+	suffix, ok := topicSuffixes[pushType]
+	if !ok {
+		return nil, errors.New("unknown push type " + string(pushType))
+	}
+
+	topic := pn.Topic
+	if len(topic) == 0 && len(defaultTopic) > 0 {
+		topic = defaultTopic
+		if !strings.HasSuffix(topic, suffix) {
+			topic += suffix
+		}
+	}
+	if len(topic) > 0 && !strings.HasSuffix(topic, suffix) {
+		return nil, errors.New(string(pushType) + " notifications must be sent to a topic ending in " + suffix)
+	}
+
+	if len(pn.CollapseID) > MaxCollapseIDBytes {
+		return nil, errors.New("collapse ID is longer than " + strconv.Itoa(MaxCollapseIDBytes) + " bytes")
+	}
+
+	id := pn.ApnsID
+	if len(id) == 0 {
+		id = identifierUUID(pn.Identifier)
+	} else if !isUUID(id) {
+		return nil, errors.New("apns-id must be a UUID")
+	}
+
+	priority := pn.Priority
+	if pushType == PushTypeBackground && priority > 5 {
+		priority = 5
+	}
+
+	header := make(http.Header)
+	header.Set("apns-id", id)
+	header.Set("apns-push-type", string(pushType))
+	header.Set("apns-expiration", strconv.FormatUint(uint64(pn.Expiry), 10))
+	if priority > 0 {
+		header.Set("apns-priority", strconv.Itoa(int(priority)))
+	}
+	if len(topic) > 0 {
+		header.Set("apns-topic", topic)
+	}
+	if len(pn.CollapseID) > 0 {
+		header.Set("apns-collapse-id", pn.CollapseID)
+	}
+	return header, nil
+}
+
+// defaultPushType works out from the payload whether the notification
+// is meant to be seen. The badge is ignored, since AddPayload always
+// sets one.
+func (pn *PushNotification) defaultPushType() PushType {
+	payload, err := pn.PayloadJSON()
+	if err != nil {
+		return PushTypeAlert
+	}
+	var aps struct {
+		Aps struct {
+			Alert            json.RawMessage `json:"alert"`
+			Sound            json.RawMessage `json:"sound"`
+			ContentAvailable int             `json:"content-available"`
+		} `json:"aps"`
+	}
+	if err := json.Unmarshal(payload, &aps); err != nil {
+		return PushTypeAlert
+	}
+	if aps.Aps.ContentAvailable == 1 && len(aps.Aps.Alert) == 0 && len(aps.Aps.Sound) == 0 {
+		return PushTypeBackground
+	}
+	return PushTypeAlert
+}
+
+// isUUID reports whether s is a UUID in its canonical
+// 8-4-4-4-12 hexadecimal form.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if c != '-' {
+				return false
+			}
+		case '0' <= c && c <= '9', 'a' <= c && c <= 'f', 'A' <= c && c <= 'F':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package apns
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHeaderDefaults(t *testing.T) {
+	pn := mockNotification(255)
+	header, err := pn.headers("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("apns-push-type") != "alert" || header.Get("apns-priority") != "10" {
+		t.Error("expected an alert at priority 10; got", header.Get("apns-push-type"), header.Get("apns-priority"))
+	}
+	if header.Get("apns-topic") != "com.example.app" {
+		t.Error("expected the default topic; got", header.Get("apns-topic"))
+	}
+	if header.Get("apns-id") != "00000000-0000-0000-0000-0000000000ff" {
+		t.Error("expected an apns-id made from the identifier; got", header.Get("apns-id"))
+	}
+	if _, ok := header["Apns-Collapse-Id"]; ok {
+		t.Error("expected no collapse ID")
+	}
+
+	background := NewPushNotification()
+	background.DeviceToken = testDeviceToken
+	payload := NewPayload()
+	payload.ContentAvailable = 1
+	background.AddPayload(payload)
+	header, err = background.headers("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("apns-push-type") != "background" || header.Get("apns-priority") != "5" {
+		t.Error("expected a background push at priority 5; got", header.Get("apns-push-type"), header.Get("apns-priority"))
+	}
+
+	voip := mockNotification(1)
+	voip.PushType = PushTypeVoIP
+	voip.CollapseID = "call"
+	voip.ApnsID = "123E4567-E89B-12D3-A456-426614174000"
+	header, err = voip.headers("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("apns-topic") != "com.example.app.voip" {
+		t.Error("expected the topic to gain the VoIP suffix; got", header.Get("apns-topic"))
+	}
+	if header.Get("apns-collapse-id") != "call" || header.Get("apns-id") != voip.ApnsID {
+		t.Error("expected the collapse ID and apns-id to be passed on; got", header)
+	}
+}
+
+func TestHeaderZeroPriority(t *testing.T) {
+	pn := mockNotification(1)
+	pn.Priority = 0
+	header, err := pn.headers("com.example.app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := header["Apns-Priority"]; ok {
+		t.Error("expected no priority header; got", header.Get("apns-priority"))
+	}
+}
+
+func TestHeaderValidation(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(pn *PushNotification)
+	}{
+		{"long collapse ID", func(pn *PushNotification) { pn.CollapseID = strings.Repeat("x", MaxCollapseIDBytes+1) }},
+		{"unknown push type", func(pn *PushNotification) { pn.PushType = "fax" }},
+		{"malformed apns-id", func(pn *PushNotification) { pn.ApnsID = "not-a-uuid" }},
+		{"topic without suffix", func(pn *PushNotification) {
+			pn.PushType = PushTypeLiveActivity
+			pn.Topic = "com.example.app"
+		}},
+	}
+	for _, test := range tests {
+		pn := mockNotification(1)
+		test.setup(pn)
+		if _, err := pn.headers(""); err == nil {
+			t.Error(test.name, "- expected an error")
+		}
+	}
+
+	pn := mockNotification(1)
+	pn.CollapseID = strings.Repeat("x", MaxCollapseIDBytes)
+	if _, err := pn.headers(""); err != nil {
+		t.Error("expected a collapse ID of exactly", MaxCollapseIDBytes, "bytes to be allowed; got", err)
+	}
+}
@@ -0,0 +1,228 @@
+package apns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// The largest payload the HTTP/2 provider API accepts.
+const MaxHTTP2PayloadSizeBytes = 4096
+
+// ErrHTTP2NotNegotiated is returned when the server at the provider
+// API's address doesn't agree to speak HTTP/2, which Apple requires.
+var ErrHTTP2NotNegotiated = errors.New("server did not negotiate HTTP/2")
+
+// HTTP2Client sends notifications through Apple's HTTP/2 provider
+// API, which has replaced the binary protocol. Apple replies to every
+// request, so unlike the binary Client there's no waiting to see
+// whether a notification was accepted, and no resending.
+//
+// Everything else comes from Client: the certificate, the proxy and
+// DialContext, ConfigureTLS and PinnedCAs. The API is found at the
+// Environment's HTTP2 address or, failing that, derived from Gateway
+// when it's one of Apple's; otherwise Gateway itself is used.
+//
+// To authenticate with a provider token rather than a certificate,
+// set Token; the Client then needs no certificate. Since a token isn't
+// tied to any one app, Apple also needs to be told the Topic, usually
+// the app's bundle ID, that notifications are for; notifications may
+// set their own. Should Apple find a
+// token has expired, a new one is signed and the notification sent
+// once more.
+//
+// Requests share a single HTTP/2 connection, which is safe for
+// concurrent use by multiple goroutines.
+type HTTP2Client struct {
+	Client *Client
+	Token  *ProviderToken
+	Topic  string
+
+	mu         sync.Mutex
+	httpClient *http.Client
+}
+
+// NewHTTP2Client creates an HTTP2Client that uses the settings of
+// the given client. No network activity happens until the first
+// notification is sent.
+func NewHTTP2Client(client *Client) *HTTP2Client {
+	return &HTTP2Client{Client: client}
+}
+
+// Send posts your push notification to the provider API. Its
+// Expiry and Priority are passed on in the apns-expiration and
+// apns-priority headers, and Topic, CollapseID, PushType and ApnsID
+// in their own. The response carries the HTTP status, the apns-id
+// Apple used and, when the notification is rejected, Apple's reason.
+//
+// When not set, PushType is background for notifications that only
+// set content-available, which are then always sent with priority 5,
+// and alert otherwise. Topic is the client's Topic, with the suffix
+// the push type calls for, such as ".voip", and ApnsID is made from
+// the Identifier. The headers are checked against Apple's rules, such
+// as the collapse ID being no longer than MaxCollapseIDBytes, before
+// anything is sent.
+func (c *HTTP2Client) Send(pn *PushNotification) (resp *PushNotificationResponse) {
+	return c.SendContext(context.Background(), pn)
+}
+
+// SendContext is like Send, but gives up once the context is
+// cancelled or its deadline passes.
+func (c *HTTP2Client) SendContext(ctx context.Context, pn *PushNotification) (resp *PushNotificationResponse) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var token string
+		if c.Token != nil {
+			var err error
+			token, err = c.Token.Token()
+			if err != nil {
+				resp = new(PushNotificationResponse)
+				resp.Identifier = pn.Identifier
+				resp.Success = false
+				resp.Error = err
+				return
+			}
+		}
+
+		resp = c.send(ctx, pn, token)
+		if resp.Reason != "ExpiredProviderToken" || c.Token == nil || !c.Token.renew(token) {
+			return
+		}
+	}
+	return
+}
+
+// send makes a single request for the notification, authenticated
+// with the given provider token if there is one.
+func (c *HTTP2Client) send(ctx context.Context, pn *PushNotification, token string) (resp *PushNotificationResponse) {
+	resp = new(PushNotificationResponse)
+	resp.Identifier = pn.Identifier
+
+	req, err := c.newRequest(ctx, pn)
+	if err != nil {
+		resp.Success = false
+		resp.Error = err
+		return
+	}
+	if len(token) > 0 {
+		req.Header.Set("authorization", "bearer "+token)
+	}
+
+	res, err := c.client().Do(req)
+	if err != nil {
+		resp.Success = false
+		resp.Error = err
+		return
+	}
+	defer res.Body.Close()
+
+	resp.HTTPStatus = res.StatusCode
+	resp.ApnsID = res.Header.Get("apns-id")
+	if res.StatusCode == http.StatusOK {
+		resp.Success = true
+		return
+	}
+
+	// Apple explains itself with a JSON body like {"reason": "BadDeviceToken"}.
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(io.LimitReader(res.Body, 4096)).Decode(&body)
+	if len(body.Reason) == 0 {
+		body.Reason = http.StatusText(res.StatusCode)
+	}
+	resp.Success = false
+	resp.Reason = body.Reason
+	resp.AppleResponse = body.Reason
+	resp.Error = errors.New(body.Reason)
+	return
+}
+
+// Close closes the connection to the provider API, if it's idle.
+// A new one is made on the next Send.
+func (c *HTTP2Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.httpClient != nil {
+		c.httpClient.CloseIdleConnections()
+	}
+	return nil
+}
+
+// newRequest builds the provider API request for a notification.
+func (c *HTTP2Client) newRequest(ctx context.Context, pn *PushNotification) (*http.Request, error) {
+	if _, err := hex.DecodeString(pn.DeviceToken); err != nil || len(pn.DeviceToken) == 0 {
+		return nil, errors.New("device token must be hexadecimal")
+	}
+	payload, err := pn.PayloadJSON()
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) > MaxHTTP2PayloadSizeBytes {
+		return nil, errors.New("payload is larger than the " + strconv.Itoa(MaxHTTP2PayloadSizeBytes) + " byte limit")
+	}
+
+	header, err := pn.headers(c.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	url := "https://" + c.Client.http2Address() + "/3/device/" + pn.DeviceToken
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// client returns the HTTP client used to talk to Apple, creating
+// it on first use. Its connections are dialed by the Client, so
+// they get the same certificate, proxy and TLS settings as any
+// other, and must negotiate HTTP/2.
+func (c *HTTP2Client) client() *http.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.httpClient == nil {
+		transport := &http.Transport{
+			DialTLSContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+				var conn *tls.Conn
+				var err error
+				// Token authentication needs no certificate.
+				if c.Token != nil && !c.Client.hasCertificate() {
+					conn, err = c.Client.dialTLS(ctx, address, new(tls.Config), "h2")
+				} else {
+					conn, err = c.Client.dialContext(ctx, address, "h2")
+				}
+				if err != nil {
+					return nil, err
+				}
+				if conn.ConnectionState().NegotiatedProtocol != "h2" {
+					conn.Close()
+					return nil, ErrHTTP2NotNegotiated
+				}
+				return conn, nil
+			},
+			ForceAttemptHTTP2: true,
+		}
+		c.httpClient = &http.Client{Transport: transport}
+	}
+	return c.httpClient
+}
+
+// identifierUUID turns a notification identifier into the
+// UUID form that apns-id requires.
+func identifierUUID(identifier int32) string {
+	id := strconv.FormatUint(uint64(uint32(identifier)), 16)
+	return "00000000-0000-0000-0000-" + "000000000000"[len(id):] + id
+}
@@ -0,0 +1,118 @@
+package apns
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newMockProvider starts a stand-in for Apple's HTTP/2 provider API and
+// returns a client set up to reach it. Requests are passed to handler.
+func newMockProvider(t *testing.T, handler http.HandlerFunc) *HTTP2Client {
+	server := httptest.NewUnstartedServer(handler)
+	server.EnableHTTP2 = true
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	client := BareClient("", string(certPEM), string(keyPEM))
+	client.Environment = CustomEnvironment("test", "", "", server.Listener.Addr().String())
+	client.ConfigureTLS = func(config *tls.Config) {
+		config.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	}
+	return NewHTTP2Client(client)
+}
+
+func TestHTTP2Send(t *testing.T) {
+	var req *http.Request
+	var body string
+	c := newMockProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		req, body = r, string(data)
+		w.Header().Set("apns-id", r.Header.Get("apns-id"))
+	})
+
+	pn := mockNotification(255)
+	pn.Expiry = 1700000000
+	pn.Priority = 5
+	resp := c.Send(pn)
+	if !resp.Success || resp.HTTPStatus != http.StatusOK {
+		t.Fatal("expected the notification to be accepted; got", resp.HTTPStatus, resp.Error)
+	}
+
+	if req.ProtoMajor != 2 {
+		t.Error("expected HTTP/2; got", req.Proto)
+	}
+	if req.Method != http.MethodPost || req.URL.Path != "/3/device/"+testDeviceToken {
+		t.Error("expected a POST to the device's path; got", req.Method, req.URL.Path)
+	}
+	if id := req.Header.Get("apns-id"); id != "00000000-0000-0000-0000-0000000000ff" || resp.ApnsID != id {
+		t.Error("expected the identifier as apns-id; got", id, resp.ApnsID)
+	}
+	if req.Header.Get("apns-expiration") != "1700000000" || req.Header.Get("apns-priority") != "5" {
+		t.Error("expected the expiry and priority headers; got", req.Header)
+	}
+	if req.Header.Get("apns-push-type") != "alert" {
+		t.Error("expected the push type header; got", req.Header.Get("apns-push-type"))
+	}
+	if want, _ := pn.PayloadString(); body != want {
+		t.Error("expected the payload as the body; got", body)
+	}
+}
+
+func TestHTTP2NotNegotiated(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no HTTP/1.1 request to be made")
+	}))
+	// A server that knows nothing of ALPN, like many a proxy.
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert, NextProtos: []string{}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	client := BareClient("", string(certPEM), string(keyPEM))
+	client.Environment = CustomEnvironment("test", "", "", server.Listener.Addr().String())
+	client.ConfigureTLS = func(config *tls.Config) {
+		config.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	}
+
+	resp := NewHTTP2Client(client).Send(mockNotification(1))
+	if resp.Success || !errors.Is(resp.Error, ErrHTTP2NotNegotiated) {
+		t.Error("expected ErrHTTP2NotNegotiated; got", resp.Error)
+	}
+}
+
+func TestHTTP2Rejected(t *testing.T) {
+	c := newMockProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"reason":"BadDeviceToken"}`)
+	})
+
+	resp := c.Send(mockNotification(1))
+	if resp.Success || resp.HTTPStatus != http.StatusBadRequest {
+		t.Fatal("expected the notification to be rejected; got", resp.HTTPStatus)
+	}
+	if resp.Reason != "BadDeviceToken" || resp.Error == nil || resp.Error.Error() != "BadDeviceToken" {
+		t.Error("expected BadDeviceToken; got", resp.Reason, resp.Error)
+	}
+}
+
+func TestHTTP2InvalidToken(t *testing.T) {
+	c := newMockProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no request to be made")
+	})
+
+	pn := mockNotification(1)
+	pn.DeviceToken = "../../etc"
+	if resp := c.Send(pn); resp.Success || !strings.Contains(resp.Error.Error(), "hexadecimal") {
+		t.Error("expected the device token to be refused; got", resp.Error)
+	}
+}
@@ -0,0 +1,27 @@
+package apns
+
+import "sync/atomic"
+
+// IdentifierAllocator hands out the identifiers Apple uses to tell
+// us which notification it rejected. Identifiers in flight on the
+// same connection must be distinct for that to be of any use.
+type IdentifierAllocator interface {
+	NextIdentifier() int32
+}
+
+// CounterAllocator allocates identifiers from an atomic counter,
+// covering the full 32-bit space before wrapping around. It is safe
+// for concurrent use, and its zero value is ready to use.
+type CounterAllocator struct {
+	last uint32
+}
+
+// NextIdentifier returns the next identifier in sequence.
+func (a *CounterAllocator) NextIdentifier() int32 {
+	return int32(atomic.AddUint32(&a.last, 1))
+}
+
+// Identifiers is the allocator used by NewPushNotification, and by
+// clients that don't have one of their own. Replace it before
+// creating any notifications if you need a different scheme.
+var Identifiers IdentifierAllocator = new(CounterAllocator)
@@ -0,0 +1,158 @@
+package apns
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockGateway is a stand-in for Apple's push gateway, listening on
+// the loopback interface. It records the identifiers of the notifications it reads
+// and rejects any listed in reject, the way Apple does: by sending an
+// error response and hanging up. It hangs up without a word on reading
+// any listed in hangUp.
+type mockGateway struct {
+	t        *testing.T
+	listener net.Listener
+	roots    *x509.CertPool
+	reject   map[int32]uint8
+	hangUp   map[int32]bool
+
+	mu       sync.Mutex
+	dials    int
+	received []int32
+}
+
+func newMockGateway(t *testing.T) *mockGateway {
+	certPEM, keyPEM := mockCertificate(t, time.Now().AddDate(1, 0, 0))
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	g := &mockGateway{t: t, listener: listener, roots: roots, reject: make(map[int32]uint8), hangUp: make(map[int32]bool)}
+	go g.accept()
+	return g
+}
+
+// client returns a client that dials the mock gateway
+// and trusts its self-signed certificate.
+func (g *mockGateway) client() *Client {
+	certPEM, keyPEM := mockCertificate(g.t, time.Now().AddDate(1, 0, 0))
+	client := BareClient("localhost:2195", string(certPEM), string(keyPEM))
+	client.DialContext = g.dial
+	client.ConfigureTLS = func(config *tls.Config) {
+		config.RootCAs = g.roots
+	}
+	return client
+}
+
+// dial connects to the mock gateway whatever the address.
+func (g *mockGateway) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	g.mu.Lock()
+	g.dials++
+	g.mu.Unlock()
+
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, network, g.listener.Addr().String())
+}
+
+func (g *mockGateway) accept() {
+	for {
+		conn, err := g.listener.Accept()
+		if err != nil {
+			return
+		}
+		go g.serve(conn)
+	}
+}
+
+func (g *mockGateway) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		identifier, err := readMockFrame(conn)
+		if err != nil {
+			return
+		}
+
+		g.mu.Lock()
+		g.received = append(g.received, identifier)
+		status, rejected := g.reject[identifier]
+		hangUp := g.hangUp[identifier]
+		g.mu.Unlock()
+
+		if hangUp {
+			return
+		}
+		if rejected {
+			reply := []byte{8, status, 0, 0, 0, 0}
+			binary.BigEndian.PutUint32(reply[2:], uint32(identifier))
+			conn.Write(reply)
+			return
+		}
+	}
+}
+
+// readMockFrame reads a command 2 frame, returning
+// the notification identifier it carries.
+func readMockFrame(r io.Reader) (identifier int32, err error) {
+	header := make([]byte, 5)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+	frame := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	if _, err = io.ReadFull(r, frame); err != nil {
+		return
+	}
+	for len(frame) >= 3 {
+		length := int(binary.BigEndian.Uint16(frame[1:3]))
+		if frame[0] == notificationIdentifierItemid {
+			identifier = int32(binary.BigEndian.Uint32(frame[3:7]))
+		}
+		frame = frame[3+length:]
+	}
+	return
+}
+
+func (g *mockGateway) receivedCount(identifier int32) (n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, id := range g.received {
+		if id == identifier {
+			n++
+		}
+	}
+	return
+}
+
+// dialCount returns the number of connections made to the gateway.
+func (g *mockGateway) dialCount() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.dials
+}
+
+func mockNotification(identifier int32) *PushNotification {
+	pn := NewPushNotification()
+	pn.Identifier = identifier
+	pn.DeviceToken = testDeviceToken
+	pn.AddPayload(mockPayload())
+	return pn
+}
@@ -0,0 +1,60 @@
+package apns
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// NewClientPKCS12 is like NewClient, but takes the certificate and
+// private key from a PKCS#12 archive (a .p12 file, as exported by
+// Keychain Access or Apple's developer portal) protected by password.
+//
+// Since there are no certificate files to go back to, such a client
+// can't reload or watch its certificate.
+func NewClientPKCS12(gateway string, data []byte, password string) (*Client, error) {
+	cert, err := decodePKCS12(data, password)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(Client)
+	c.Gateway = gateway
+	c.useCertificate(cert)
+	return c, nil
+}
+
+// NewClientPKCS12File is like NewClientPKCS12, but reads
+// the archive from the given path.
+func NewClientPKCS12File(gateway, path, password string) (*Client, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientPKCS12(gateway, data, password)
+}
+
+// decodePKCS12 extracts the certificate and private key from a
+// PKCS#12 archive, whether it was encrypted the old way or with the
+// PBES2 and AES that OpenSSL 3 uses by default. Any intermediate
+// certificates the archive carries are sent along with the leaf.
+func decodePKCS12(data []byte, password string) (cert tls.Certificate, err error) {
+	key, leaf, intermediates, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return
+	}
+	if leaf == nil || key == nil {
+		err = errors.New("PKCS#12 data must contain a certificate and a private key")
+		return
+	}
+
+	cert.Certificate = [][]byte{leaf.Raw}
+	for _, c := range intermediates {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	cert.PrivateKey = key
+	cert.Leaf = leaf
+	return
+}
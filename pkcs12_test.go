@@ -0,0 +1,95 @@
+package apns
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// Generated with OpenSSL 3's defaults (PBES2 with AES-256-CBC) by
+// "openssl pkcs12 -export -certfile ca.pem -passout pass:secret", for
+// a leaf certificate issued by ca.pem.
+const testPKCS12 = `
+MIIFfAIBAzCCBTIGCSqGSIb3DQEHAaCCBSMEggUfMIIFGzCCA9IGCSqGSIb3DQEH
+BqCCA8MwggO/AgEAMIIDuAYJKoZIhvcNAQcBMFcGCSqGSIb3DQEFDTBKMCkGCSqG
+SIb3DQEFDDAcBAiwGflkFl0WWgICCAAwDAYIKoZIhvcNAgkFADAdBglghkgBZQME
+ASoEEGmdMteQBnihdBfukrY52WyAggNQdykcmd4n93X6uegEb8EVCUvk8HzS16mg
+cpcOuIiu/0OEqJtNoSBlU3BMWELQe7nFwDkh9zJhT4hEwdrQK28h7snuoGMZ64Ld
+FvIiNlAnqkJQFmCHhGkcyIa2XlW1bxmXejXdzfuINGx3I4RDzIoTJnc9lVGCYTza
+O97AvE2gNB//Z/1qKuPWiPA2hFrJ5ydnC17b/a5mqyBJTP+W1hROkTw2jG2rMCVH
+oUZZLYSWRh9lBzymyMQH3OZCCcwOWoahIqfOkiMlyOk+8St29GGTeMad0UNXFi7H
+C5/xlZVn6uaIZK8QoN0g8uDtN9ORapHzsVRhQqNnQ6F3Qc1J8yNjrNxfHm8mBTMB
+2ApV3oN1RTmNucZVfkcsAxaLs3O9z9yTuswTiS6pwxwfFYglY1ohSCeQkZvC/5VM
+av2aXq1TIiYkwbTPX6RaskhPyRSq0sVQRC8W7U9uOUq8k6G5kkyx48RrzPoMgyML
+R7mNZSeNc075TaAw8skoFHj+nyql6pH6rajzSqrKt+LgAb3xK7oOWdjEsjuvWlLu
+h8+I4OKH6jHmBMLIOLKaBfUXR4oy6mSkyz7ZSkCBHU3zBiFgZPUx5WhulYIMRcR+
+qInU2IAU6FLpdjpBC6TcvLywCshp/uZLwwYuFYyWjzU/oLN9vIGFGjoJfHKgbCsh
+ibikQuXqECnLtUyA9pmk5RXMMkpAkOkkuPs7qs2nEoDdX1rLv0Wn5tpVDOFbOeNq
+epNFLAauzqfNSsLnW9EswyYn8FXX/281K5vd3XIsrw4KHsSWKgNCyoBAZvuyqKO1
+rDo2nory8BhA8K9cScJI6LmQ6WGvwQkkBxpvfeNFLmP4kDNa5H1TkgupTTq9s1hx
+PfHFxXW/s4NrD4mGHjzopoHc2OMOhG8oPxUMCdQL6Lp30PkNwtXzp6NiD+I8twZQ
+8/PKnrbUsip0ZJvPmuob24Sn+cVDFn5QZ7M+hYAEOOOdy6Egmsjz/6vFdREaHUJh
+g6SEyG+gOa/O+mQFdEwpzWOcTVxE5VhBwrhaveL2INpzUC/JSqm10rzLWdHWs57C
+xzeKFRw/G1gwVpNeBwUnPRTDu07ywwttXy5ZC0xf7KPQZFJMkwP29GbjFo9ZGPv1
+DSI7GtxiS9wwggFBBgkqhkiG9w0BBwGgggEyBIIBLjCCASowggEmBgsqhkiG9w0B
+DAoBAqCB7zCB7DBXBgkqhkiG9w0BBQ0wSjApBgkqhkiG9w0BBQwwHAQITdN1zMvt
+Yy4CAggAMAwGCCqGSIb3DQIJBQAwHQYJYIZIAWUDBAEqBBDWtoBfhPYEN/TovKnK
+IGQDBIGQOP5kOrh5t4w5/k9gzkub3sXkFStLQr2MxTnRrfTUfgTBdSZije3Epq47
+pO2PVPbOPU5JD3wDc2bY4l8UAuZSS3dWj378//RX7RkWj9R4U+HXmmG4TGm86w1A
+SydYJLfrkwzi1UxgZd2PgY85KTtLAheK9gAE8BTkkI0xJxe3g3i9oYj+b4TJpL7m
+z6Fh8pmzMSUwIwYJKoZIhvcNAQkVMRYEFPDl4uqBK9TPJ3v3AdI7qBM0LWm4MEEw
+MTANBglghkgBZQMEAgEFAAQgTEwGB/Mqiz/LsGNbNYTqyAJGiyorbJR6Cycs3lB4
+S+oECHlb7JjTqzzNAgIIAA==
+`
+
+func decodeTestPKCS12(t *testing.T) []byte {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(testPKCS12), ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNewClientPKCS12(t *testing.T) {
+	client, err := NewClientPKCS12("gateway.sandbox.push.apple.com:2195", decodeTestPKCS12(t), "secret")
+	if err != nil {
+		t.Fatal("expected the archive to decode; got", err)
+	}
+	cert, err := client.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cert.Certificate) != 2 {
+		t.Error("expected the leaf and its issuer; got", len(cert.Certificate), "certificates")
+	}
+	if cert.Leaf == nil || cert.Leaf.Subject.CommonName != "Apple Push Services: com.example.app" {
+		t.Error("expected the push certificate as the leaf; got", cert.Leaf)
+	}
+	if cert.PrivateKey == nil {
+		t.Error("expected the private key")
+	}
+}
+
+func TestNewClientPKCS12WrongPassword(t *testing.T) {
+	_, err := NewClientPKCS12("gateway.sandbox.push.apple.com:2195", decodeTestPKCS12(t), "wrong")
+	if !errors.Is(err, pkcs12.ErrIncorrectPassword) {
+		t.Error("expected pkcs12.ErrIncorrectPassword; got", err)
+	}
+}
+
+func TestNewClientPKCS12Invalid(t *testing.T) {
+	_, err := NewClientPKCS12("gateway.sandbox.push.apple.com:2195", []byte("not a p12 archive"), "secret")
+	if err == nil {
+		t.Error("expected an error for invalid PKCS#12 data")
+	}
+}
+
+func TestNewClientPKCS12FileMissing(t *testing.T) {
+	_, err := NewClientPKCS12File("gateway.sandbox.push.apple.com:2195", "missing.p12", "secret")
+	if err == nil {
+		t.Error("expected an error for a missing PKCS#12 file")
+	}
+}
@@ -0,0 +1,154 @@
+package apns
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Pool spreads notifications across several Connections to the
+// same gateway, handing them out in round-robin order. A single
+// connection is limited by the round trip of each TLS write, so
+// large fan-outs finish much sooner when spread over a few of them.
+//
+// Each Connection re-dials on its own after an error, so a dead
+// session is replaced the next time a notification is routed to it.
+// A Pool is safe for concurrent use by multiple goroutines.
+type Pool struct {
+	client *Client
+
+	mu     sync.RWMutex
+	conns  []*Connection
+	next   uint32
+	closed bool
+}
+
+// NewPool creates a Pool of size connections for the given client.
+// Connections are dialed lazily, as notifications are sent on them.
+func NewPool(client *Client, size int) *Pool {
+	p := &Pool{client: client}
+	p.Resize(size)
+	return p
+}
+
+// Send writes your push notification to the next connection in
+// the pool. See Connection.Send for what the response means.
+func (p *Pool) Send(pn *PushNotification) (resp *PushNotificationResponse) {
+	return p.SendContext(context.Background(), pn)
+}
+
+// SendContext is like Send, but gives up dialing or writing
+// once the context is cancelled or its deadline passes.
+func (p *Pool) SendContext(ctx context.Context, pn *PushNotification) (resp *PushNotificationResponse) {
+	conn := p.pick()
+	if conn == nil {
+		resp = new(PushNotificationResponse)
+		resp.Success = false
+		resp.Error = ErrConnectionClosed
+		return
+	}
+	return conn.SendContext(ctx, pn)
+}
+
+// SendBatch writes your push notifications, in order, to the next
+// connection in the pool. See Connection.SendBatch.
+func (p *Pool) SendBatch(pns []*PushNotification) (resps []*PushNotificationResponse) {
+	return p.SendBatchContext(context.Background(), pns)
+}
+
+// SendBatchContext is like SendBatch, but gives up dialing or
+// writing once the context is cancelled or its deadline passes.
+func (p *Pool) SendBatchContext(ctx context.Context, pns []*PushNotification) (resps []*PushNotificationResponse) {
+	conn := p.pick()
+	if conn == nil {
+		resps = make([]*PushNotificationResponse, len(pns))
+		for i, pn := range pns {
+			resps[i] = new(PushNotificationResponse)
+			resps[i].Identifier = pn.Identifier
+			resps[i].Success = false
+			resps[i].Error = ErrConnectionClosed
+		}
+		return
+	}
+	return conn.SendBatchContext(ctx, pns)
+}
+
+// Size returns the number of connections in the pool.
+func (p *Pool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.conns)
+}
+
+// Resize grows or shrinks the pool to the given number of connections,
+// which is never less than one. Surplus connections are closed.
+func (p *Pool) Resize(size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return
+	}
+	for len(p.conns) < size {
+		p.conns = append(p.conns, NewConnection(p.client))
+	}
+	for _, conn := range p.conns[size:] {
+		conn.Close()
+	}
+	p.conns = p.conns[:size]
+}
+
+// Close shuts down every connection in the pool. Any further
+// sends will fail with ErrConnectionClosed.
+func (p *Pool) Close() (err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, conn := range p.conns {
+		if cerr := conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	p.conns = nil
+	return
+}
+
+// Drain drains every connection in the pool at once (see
+// Connection.Drain) and then closes the pool. Any further sends
+// will fail with ErrConnectionClosed.
+func (p *Pool) Drain(ctx context.Context) (err error) {
+	p.mu.Lock()
+	p.closed = true
+	conns := p.conns
+	p.conns = nil
+	p.mu.Unlock()
+
+	errs := make(chan error, len(conns))
+	for _, conn := range conns {
+		go func(conn *Connection) { errs <- conn.Drain(ctx) }(conn)
+	}
+	for range conns {
+		if derr := <-errs; derr != nil && err == nil {
+			err = derr
+		}
+	}
+	return
+}
+
+// pick returns the next connection in round-robin order,
+// or nil once the pool has been closed.
+func (p *Pool) pick() *Connection {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.conns) == 0 {
+		return nil
+	}
+	n := atomic.AddUint32(&p.next, 1)
+	return p.conns[n%uint32(len(p.conns))]
+}
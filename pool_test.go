@@ -0,0 +1,47 @@
+package apns
+
+import "testing"
+
+func TestPoolResize(t *testing.T) {
+	p := NewPool(NewClient("", "", ""), 0)
+	if p.Size() != 1 {
+		t.Error("expected a pool of at least 1 connection; got", p.Size())
+	}
+
+	p.Resize(4)
+	if p.Size() != 4 {
+		t.Error("expected 4 connections; got", p.Size())
+	}
+
+	p.Resize(2)
+	if p.Size() != 2 {
+		t.Error("expected 2 connections; got", p.Size())
+	}
+}
+
+func TestPoolRoundRobin(t *testing.T) {
+	p := NewPool(NewClient("", "", ""), 3)
+
+	seen := make(map[*Connection]int)
+	for i := 0; i < 9; i++ {
+		seen[p.pick()]++
+	}
+	if len(seen) != 3 {
+		t.Fatal("expected all 3 connections to be used; got", len(seen))
+	}
+	for _, n := range seen {
+		if n != 3 {
+			t.Error("expected each connection to be picked 3 times; got", n)
+		}
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	p := NewPool(NewClient("", "", ""), 2)
+	p.Close()
+
+	resp := p.Send(NewPushNotification())
+	if resp.Success || resp.Error != ErrConnectionClosed {
+		t.Error("expected ErrConnectionClosed; got", resp.Error)
+	}
+}
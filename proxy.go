@@ -0,0 +1,258 @@
+package apns
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyFromEnvironment returns the proxy to use for connections to the
+// given address according to the HTTPS_PROXY, ALL_PROXY and NO_PROXY
+// environment variables (or their lowercase forms), or nil if none.
+func proxyFromEnvironment(address string) (*url.URL, error) {
+	proxy := getenv("HTTPS_PROXY")
+	if len(proxy) == 0 {
+		proxy = getenv("ALL_PROXY")
+	}
+	if len(proxy) == 0 || bypassProxy(hostname(address), getenv("NO_PROXY")) {
+		return nil, nil
+	}
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	return url.Parse(proxy)
+}
+
+func getenv(name string) string {
+	if v := os.Getenv(name); len(v) > 0 {
+		return v
+	}
+	return os.Getenv(strings.ToLower(name))
+}
+
+// bypassProxy reports whether the host is matched by the
+// comma-separated NO_PROXY list of hosts and domain suffixes.
+func bypassProxy(host, noProxy string) bool {
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimSpace(entry)
+		if len(entry) == 0 {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		// Both "apple.com" and ".apple.com" match apple.com
+		// and any of its subdomains.
+		domain := strings.TrimLeft(hostname(entry), "*.")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyURL returns the proxy connections to the given
+// address should go through, if any.
+func (client *Client) proxyURL(address string) (*url.URL, error) {
+	if client.Proxy != nil {
+		return client.Proxy, nil
+	}
+	if client.ProxyFromEnvironment {
+		return proxyFromEnvironment(address)
+	}
+	return nil, nil
+}
+
+// dialConn opens a plain connection to the given address, either
+// directly or tunnelled through the client's proxy.
+func (client *Client) dialConn(ctx context.Context, address string) (net.Conn, error) {
+	dial := client.DialContext
+	if dial == nil {
+		dialer := net.Dialer{KeepAlive: client.KeepAlive}
+		dial = dialer.DialContext
+	}
+
+	proxy, err := client.proxyURL(address)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return dial(ctx, "tcp", address)
+	}
+	return dialProxy(ctx, dial, proxy, address)
+}
+
+// dialProxy connects to the proxy using dial and asks it
+// for a tunnel to the given address.
+func dialProxy(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), proxy *url.URL, address string) (net.Conn, error) {
+	var connect func(conn net.Conn, proxy *url.URL, address string) error
+	var port string
+	switch proxy.Scheme {
+	case "http":
+		connect, port = httpConnect, "80"
+	case "socks5", "socks5h":
+		connect, port = socks5Connect, "1080"
+	default:
+		return nil, errors.New("unsupported proxy scheme " + proxy.Scheme)
+	}
+
+	proxyAddress := proxy.Host
+	if len(proxy.Port()) == 0 {
+		proxyAddress = net.JoinHostPort(proxy.Hostname(), port)
+	}
+	conn, err := dial(ctx, "tcp", proxyAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bound the negotiation with the proxy by the context.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	err = connect(conn, proxy, address)
+	if !stop() || ctx.Err() != nil {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// httpConnect asks an HTTP proxy for a tunnel with the CONNECT method.
+func httpConnect(conn net.Conn, proxy *url.URL, address string) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	// The proxy won't say anything more until we do,
+	// so there's nothing left buffered to lose.
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New("proxy refused to connect: " + resp.Status)
+	}
+	return nil
+}
+
+// socks5Connect asks a SOCKS5 proxy (RFC 1928) for a tunnel, leaving
+// it to resolve the host name. Username and password authentication
+// (RFC 1929) is used if the proxy URL carries credentials.
+func socks5Connect(conn net.Conn, proxy *url.URL, address string) error {
+	host, portString, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	method := byte(0x00) // no authentication required
+	if proxy.User != nil {
+		method = 0x02 // username and password
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("SOCKS5 proxy doesn't support the authentication method")
+	}
+
+	if method == 0x02 {
+		username := proxy.User.Username()
+		password, _ := proxy.User.Password()
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("SOCKS5 credentials are too long")
+		}
+		auth := []byte{1, byte(len(username))}
+		auth = append(auth, username...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("SOCKS5 proxy rejected the credentials")
+		}
+	}
+
+	req := []byte{5, 1, 0} // CONNECT
+	if ip := net.ParseIP(host); ip != nil && ip.To4() != nil {
+		req = append(append(req, 1), ip.To4()...)
+	} else if ip != nil {
+		req = append(append(req, 4), ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return errors.New("host name is too long for SOCKS5")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	// version, status, reserved, address type
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[1] != 0 {
+		return errors.New("SOCKS5 proxy failed to connect: status " + strconv.Itoa(int(header[1])))
+	}
+
+	// Skip over the address the proxy bound, and its port.
+	var skip int
+	switch header[3] {
+	case 1:
+		skip = net.IPv4len + 2
+	case 4:
+		skip = net.IPv6len + 2
+	case 3:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return err
+		}
+		skip = int(length[0]) + 2
+	default:
+		return errors.New("SOCKS5 proxy sent an unknown address type")
+	}
+	_, err = io.ReadFull(conn, make([]byte, skip))
+	return err
+}
@@ -1,14 +1,10 @@
 package apns
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
-	"math/rand"
 	"strconv"
-	"time"
 )
 
 // Push commands always start with command value 2.
@@ -17,9 +13,9 @@ const pushCommandValue = 2
 // Your total notification payload cannot exceed 2 KB.
 const MaxPayloadSizeBytes = 2048
 
-// Every push notification gets a pseudo-unique identifier;
-// this establishes the upper boundary for it. Apple will return
-// this identifier if there is an issue sending your notification.
+// Push notifications used to get a pseudo-random identifier below
+// this boundary, which made collisions all too likely. Identifiers
+// now come from the Identifiers allocator instead.
 const IdentifierUbound = 9999
 
 // Constants related to the payload fields and their lengths.
@@ -74,20 +70,30 @@ func NewAlertDictionary() *AlertDictionary {
 
 // PushNotification is the wrapper for the Payload.
 // The length fields are computed in ToBytes() and aren't represented here.
+//
+// Topic, CollapseID, PushType and ApnsID are only sent through the
+// HTTP/2 provider API, as the apns-topic, apns-collapse-id,
+// apns-push-type and apns-id headers; sensible defaults are used
+// for any left empty (see HTTP2Client.Send).
 type PushNotification struct {
 	Identifier  int32
 	Expiry      uint32
 	DeviceToken string
 	payload     map[string]interface{}
 	Priority    uint8
+	Topic       string
+	CollapseID  string
+	PushType    PushType
+	ApnsID      string
 }
 
 // NewPushNotification creates and returns a PushNotification structure.
-// It also initializes the pseudo-random identifier.
+// It also allocates the identifier Apple will return if there is an
+// issue sending your notification.
 func NewPushNotification() (pn *PushNotification) {
 	pn = new(PushNotification)
 	pn.payload = make(map[string]interface{})
-	pn.Identifier = rand.New(rand.NewSource(time.Now().UnixNano())).Int31n(IdentifierUbound)
+	pn.Identifier = Identifiers.NextIdentifier()
 	pn.Priority = 10
 	return
 }
@@ -138,41 +144,25 @@ func (pn *PushNotification) PayloadString() (string, error) {
 // ToBytes returns a byte array of the complete PushNotification
 // struct. This array is what should be transmitted to the APN Service.
 func (pn *PushNotification) ToBytes() ([]byte, error) {
-	token, err := hex.DecodeString(pn.DeviceToken)
+	return pn.Encode(FrameFormat)
+}
+
+// tokenAndPayload returns the device token and the JSON payload,
+// checking that both are fit to be sent.
+func (pn *PushNotification) tokenAndPayload() (token, payload []byte, err error) {
+	token, err = hex.DecodeString(pn.DeviceToken)
 	if err != nil {
-		return nil, err
+		return
 	}
 	if len(token) != deviceTokenLength {
-		return nil, errors.New("device token has incorrect length")
+		return nil, nil, errors.New("device token has incorrect length")
 	}
-	payload, err := pn.PayloadJSON()
+	payload, err = pn.PayloadJSON()
 	if err != nil {
-		return nil, err
+		return
 	}
 	if len(payload) > MaxPayloadSizeBytes {
-		return nil, errors.New("payload is larger than the " + strconv.Itoa(MaxPayloadSizeBytes) + " byte limit")
+		return nil, nil, errors.New("payload is larger than the " + strconv.Itoa(MaxPayloadSizeBytes) + " byte limit")
 	}
-
-	frameBuffer := new(bytes.Buffer)
-	binary.Write(frameBuffer, binary.BigEndian, uint8(deviceTokenItemid))
-	binary.Write(frameBuffer, binary.BigEndian, uint16(deviceTokenLength))
-	binary.Write(frameBuffer, binary.BigEndian, token)
-	binary.Write(frameBuffer, binary.BigEndian, uint8(payloadItemid))
-	binary.Write(frameBuffer, binary.BigEndian, uint16(len(payload)))
-	binary.Write(frameBuffer, binary.BigEndian, payload)
-	binary.Write(frameBuffer, binary.BigEndian, uint8(notificationIdentifierItemid))
-	binary.Write(frameBuffer, binary.BigEndian, uint16(notificationIdentifierLength))
-	binary.Write(frameBuffer, binary.BigEndian, pn.Identifier)
-	binary.Write(frameBuffer, binary.BigEndian, uint8(expirationDateItemid))
-	binary.Write(frameBuffer, binary.BigEndian, uint16(expirationDateLength))
-	binary.Write(frameBuffer, binary.BigEndian, pn.Expiry)
-	binary.Write(frameBuffer, binary.BigEndian, uint8(priorityItemid))
-	binary.Write(frameBuffer, binary.BigEndian, uint16(priorityLength))
-	binary.Write(frameBuffer, binary.BigEndian, pn.Priority)
-
-	buffer := bytes.NewBuffer([]byte{})
-	binary.Write(buffer, binary.BigEndian, uint8(pushCommandValue))
-	binary.Write(buffer, binary.BigEndian, uint32(frameBuffer.Len()))
-	binary.Write(buffer, binary.BigEndian, frameBuffer.Bytes())
-	return buffer.Bytes(), nil
+	return
 }
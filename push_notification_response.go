@@ -21,9 +21,24 @@ var ApplePushResponses = map[uint8]string{
 }
 
 // PushNotificationResponse details what Apple had to say, if anything.
+// Identifier is that of the notification the response is about.
+// When Apple rejects a notification, StatusCode holds the status it
+// sent, AppleResponse its name and Error the *ErrorResponse itself.
+// If Apple closes the connection without saying why, Error is
+// ErrClosedWithoutResponse (or ErrTruncatedResponse, should it hang
+// up mid-response); any other Error means the connection failed.
+//
+// Responses from the HTTP/2 provider API also carry the HTTPStatus,
+// the ApnsID Apple knows the notification by and, on failure, the
+// Reason Apple gave, which is repeated in AppleResponse.
 type PushNotificationResponse struct {
+	Identifier    int32
 	Success       bool
+	StatusCode    uint8
 	AppleResponse string
+	HTTPStatus    int
+	ApnsID        string
+	Reason        string
 	Error         error
 }
 
@@ -110,3 +110,24 @@ func TestZeroBadgeChangesToNegativeOne(t *testing.T) {
 		t.Error("expected 0 badge value to be converted to -1; got", payload.Badge)
 	}
 }
+
+func TestUniqueIdentifiers(t *testing.T) {
+	seen := make(map[int32]bool)
+	for i := 0; i < 100000; i++ {
+		pn := NewPushNotification()
+		if seen[pn.Identifier] {
+			t.Fatal("identifier", pn.Identifier, "was allocated twice")
+		}
+		seen[pn.Identifier] = true
+	}
+}
+
+func TestCounterAllocatorWraps(t *testing.T) {
+	a := &CounterAllocator{last: 1<<32 - 2}
+	if id := a.NextIdentifier(); id != -1 {
+		t.Error("expected the identifier after 2^31-1 to use the full 32 bits; got", id)
+	}
+	if id := a.NextIdentifier(); id != 0 {
+		t.Error("expected the counter to wrap around to 0; got", id)
+	}
+}
@@ -0,0 +1,218 @@
+package apns
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// DefaultQueueSize is the number of notifications that may be
+// waiting to be written when QueueSize isn't set on the Client.
+const DefaultQueueSize = 1000
+
+// ErrQueueFull is returned by Enqueue when the client already
+// has QueueSize notifications waiting to be written.
+var ErrQueueFull = errors.New("notification queue is full")
+
+// result pairs a notification with what became of it.
+type result struct {
+	pn   *PushNotification
+	resp *PushNotificationResponse
+}
+
+// Enqueue queues your push notification to be written on the
+// client's persistent connections and returns immediately. It
+// doesn't wait for the notification to be written, let alone for
+// Apple's verdict; read the Results channel to find out what became
+// of it.
+//
+// Notifications are always sent over persistent connections,
+// whether or not Persistent is set. They're written by one goroutine
+// per pooled connection, started by the first Enqueue; resizing the
+// pool afterwards spreads their writes over the new number of
+// connections, but doesn't change how many goroutines there are
+// until the queue starts afresh after Close or Drain.
+func (client *Client) Enqueue(pn *PushNotification) error {
+	client.queueMu.Lock()
+	defer client.queueMu.Unlock()
+
+	if client.draining {
+		return ErrConnectionClosed
+	}
+	if client.queue == nil {
+		client.startQueue()
+	}
+	select {
+	case client.queue <- pn:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Results returns a channel that receives a response for every
+// notification written on the client's persistent connections,
+// correlated by Identifier. A notification is reported as soon as
+// Apple rejects it, or as accepted once a later notification is
+// rejected or TimeoutSeconds pass without complaint.
+//
+// Results are only delivered once this has been called, after which
+// the channel must be drained: sending blocks while it's full.
+func (client *Client) Results() <-chan *PushNotificationResponse {
+	client.queueMu.Lock()
+	defer client.queueMu.Unlock()
+
+	if client.results == nil {
+		client.results = make(chan *PushNotificationResponse, client.queueSize())
+	}
+	return client.results
+}
+
+// report passes what became of each notification to the
+// ErrorHandler, if it was rejected, and the Results channel.
+func (client *Client) report(results []result) {
+	if len(results) == 0 {
+		return
+	}
+
+	client.queueMu.Lock()
+	ch := client.results
+	client.queueMu.Unlock()
+
+	for _, r := range results {
+		if !r.resp.Success && client.ErrorHandler != nil {
+			client.ErrorHandler(r.pn, r.resp)
+		}
+		if ch != nil {
+			ch <- r.resp
+		}
+	}
+}
+
+func (client *Client) queueSize() int {
+	if client.QueueSize > 0 {
+		return client.QueueSize
+	}
+	return DefaultQueueSize
+}
+
+// startQueue starts one worker per pooled connection to write
+// enqueued notifications. The caller must hold client.queueMu.
+func (client *Client) startQueue() {
+	client.queue = make(chan *PushNotification, client.queueSize())
+	client.stop = make(chan struct{})
+	client.workers = new(sync.WaitGroup)
+
+	pool := client.Pool()
+	for i := 0; i < pool.Size(); i++ {
+		client.workers.Add(1)
+		go client.work(pool, client.queue, client.stop, client.workers)
+	}
+}
+
+// detachQueue takes the queue away from the client, so that the
+// next Enqueue starts afresh, and returns it with its workers.
+func (client *Client) detachQueue() (queue chan *PushNotification, stop chan struct{}, workers *sync.WaitGroup) {
+	client.queueMu.Lock()
+	defer client.queueMu.Unlock()
+
+	queue, stop, workers = client.queue, client.stop, client.workers
+	client.queue, client.stop, client.workers = nil, nil, nil
+	return
+}
+
+// stopQueue stops the workers and fails whatever they left behind.
+func (client *Client) stopQueue() {
+	queue, stop, _ := client.detachQueue()
+	if queue == nil {
+		return
+	}
+	close(stop)
+	client.failQueued(queue)
+}
+
+// drainQueue lets the workers write everything that's queued before
+// they stop. If the context ends first, the rest fail instead.
+func (client *Client) drainQueue(ctx context.Context) {
+	queue, stop, workers := client.detachQueue()
+	if queue == nil {
+		return
+	}
+	close(queue)
+
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		close(stop)
+		client.failQueued(queue)
+	}
+}
+
+// failQueued reports everything left in the queue as
+// failed with ErrConnectionClosed.
+func (client *Client) failQueued(queue <-chan *PushNotification) {
+	var results []result
+	for {
+		select {
+		case pn, ok := <-queue:
+			if !ok {
+				client.report(results)
+				return
+			}
+			resp := new(PushNotificationResponse)
+			resp.Success = false
+			resp.Identifier = pn.Identifier
+			resp.Error = ErrConnectionClosed
+			results = append(results, result{pn, resp})
+		default:
+			client.report(results)
+			return
+		}
+	}
+}
+
+// work writes notifications from the queue until told to stop.
+// Anything that can't even be written is reported straight away;
+// everything else is reported by the connection in due course.
+func (client *Client) work(pool *Pool, queue <-chan *PushNotification, stop <-chan struct{}, workers *sync.WaitGroup) {
+	defer workers.Done()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case pn, ok := <-queue:
+			if !ok {
+				return
+			}
+
+			// Write whatever else is already waiting along with it.
+			batch := []*PushNotification{pn}
+		collect:
+			for len(batch) < maxCoalesced {
+				select {
+				case pn, ok := <-queue:
+					if !ok {
+						break collect
+					}
+					batch = append(batch, pn)
+				default:
+					break collect
+				}
+			}
+
+			var failed []result
+			for i, resp := range pool.SendBatch(batch) {
+				if !resp.Success {
+					failed = append(failed, result{batch[i], resp})
+				}
+			}
+			client.report(failed)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package apns
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEnqueueResults(t *testing.T) {
+	g := newMockGateway(t)
+	g.reject[3] = 8
+
+	client := g.client()
+	results := client.Results()
+	defer client.Close()
+
+	for i := int32(1); i <= 3; i++ {
+		if err := client.Enqueue(mockNotification(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Notifications written before the rejected one
+	// must have been accepted.
+	outcomes := make(map[int32]bool)
+	for len(outcomes) < 3 {
+		select {
+		case resp := <-results:
+			outcomes[resp.Identifier] = resp.Success
+		case <-time.After(time.Second):
+			t.Fatal("expected results for all 3 notifications; got", outcomes)
+		}
+	}
+	if !outcomes[1] || !outcomes[2] || outcomes[3] {
+		t.Error("expected 1 and 2 to be accepted and 3 rejected; got", outcomes)
+	}
+}
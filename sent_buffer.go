@@ -0,0 +1,134 @@
+package apns
+
+import "time"
+
+// DefaultResendBufferSize is the number of recently written
+// notifications a Connection remembers when ResendBufferSize
+// isn't set on the Client.
+const DefaultResendBufferSize = 1000
+
+// sentNotification is a notification along with the exact
+// bytes that were written to the gateway for it, and when.
+type sentNotification struct {
+	pn      *PushNotification
+	payload []byte
+	sent    time.Time
+}
+
+// sentBuffer is a fixed-size ring of the notifications most
+// recently written on a single TLS session, oldest first.
+//
+// When Apple rejects a notification it closes the connection and
+// discards everything written after it; the buffer lets us work out
+// what those were so they can be sent again.
+//
+// Since Apple never acknowledges a notification it accepts, we
+// also keep track of which entries have yet to be confirmed. These
+// are always the newest ones, as confirmation happens in order.
+type sentBuffer struct {
+	items   []sentNotification
+	ids     map[int32]int
+	start   int
+	count   int
+	pending int
+}
+
+func newSentBuffer(size int) *sentBuffer {
+	if size <= 0 {
+		size = DefaultResendBufferSize
+	}
+	return &sentBuffer{
+		items: make([]sentNotification, size),
+		ids:   make(map[int32]int),
+	}
+}
+
+// has reports whether a notification with the given
+// identifier is in the buffer.
+func (b *sentBuffer) has(identifier int32) bool {
+	return b.ids[identifier] > 0
+}
+
+// add records a notification, evicting the oldest entry if full.
+// If that entry was still unconfirmed it is returned, since we'll
+// no longer be able to tell what becomes of it.
+func (b *sentBuffer) add(pn *PushNotification, payload []byte, now time.Time) (evicted *sentNotification) {
+	n := len(b.items)
+	entry := sentNotification{pn, payload, now}
+	b.ids[pn.Identifier]++
+	if b.count == n {
+		old := b.items[b.start]
+		if b.pending == n {
+			evicted = &old
+			b.pending--
+		}
+		if b.ids[old.pn.Identifier]--; b.ids[old.pn.Identifier] == 0 {
+			delete(b.ids, old.pn.Identifier)
+		}
+		b.items[b.start] = entry
+		b.start = (b.start + 1) % n
+		b.pending++
+		return
+	}
+	b.items[(b.start+b.count)%n] = entry
+	b.count++
+	b.pending++
+	return
+}
+
+// at returns the i'th oldest entry.
+func (b *sentBuffer) at(i int) sentNotification {
+	return b.items[(b.start+i)%len(b.items)]
+}
+
+// confirm marks every unconfirmed entry written before the
+// given time as confirmed, returning them.
+func (b *sentBuffer) confirm(before time.Time) (confirmed []sentNotification) {
+	for b.pending > 0 {
+		entry := b.at(b.count - b.pending)
+		if !entry.sent.Before(before) {
+			break
+		}
+		confirmed = append(confirmed, entry)
+		b.pending--
+	}
+	return
+}
+
+// unconfirmed marks every remaining entry as confirmed,
+// returning those that weren't already.
+func (b *sentBuffer) unconfirmed() (entries []sentNotification) {
+	for i := b.count - b.pending; i < b.count; i++ {
+		entries = append(entries, b.at(i))
+	}
+	b.pending = 0
+	return
+}
+
+// split finds the most recent unconfirmed notification with the
+// given identifier and returns it along with the unconfirmed ones
+// written after it. If there's no such notification it has either
+// already been confirmed or evicted, so every unconfirmed entry in
+// the buffer must have followed it.
+//
+// Apple processes notifications in order, so any unconfirmed entries
+// written before the match are returned as accepted.
+func (b *sentBuffer) split(identifier int32) (accepted []sentNotification, match *sentNotification, after []sentNotification) {
+	first := b.count - b.pending
+	i := b.count - 1
+	for ; i >= first; i-- {
+		if b.at(i).pn.Identifier == identifier {
+			entry := b.at(i)
+			match = &entry
+			break
+		}
+	}
+	for j := first; j < i; j++ {
+		accepted = append(accepted, b.at(j))
+	}
+	for j := i + 1; j < b.count; j++ {
+		after = append(after, b.at(j))
+	}
+	b.pending = 0
+	return
+}
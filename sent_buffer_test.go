@@ -0,0 +1,117 @@
+package apns
+
+import (
+	"testing"
+	"time"
+)
+
+var sentEpoch = time.Date(2015, 11, 29, 0, 0, 0, 0, time.UTC)
+
+// Each notification is written one second after the last.
+func fillSentBuffer(size int, identifiers ...int32) *sentBuffer {
+	b := newSentBuffer(size)
+	for i, id := range identifiers {
+		pn := NewPushNotification()
+		pn.Identifier = id
+		b.add(pn, nil, sentEpoch.Add(time.Duration(i)*time.Second))
+	}
+	return b
+}
+
+func TestSentBufferSplit(t *testing.T) {
+	b := fillSentBuffer(10, 1, 2, 3, 4, 5)
+
+	accepted, failed, after := b.split(3)
+	if failed == nil || failed.pn.Identifier != 3 {
+		t.Fatal("expected to find notification 3")
+	}
+	if len(accepted) != 2 {
+		t.Error("expected notifications 1 and 2 to be accepted; got", accepted)
+	}
+	if len(after) != 2 || after[0].pn.Identifier != 4 || after[1].pn.Identifier != 5 {
+		t.Error("expected notifications 4 and 5 to follow 3; got", after)
+	}
+}
+
+func TestSentBufferSplitLast(t *testing.T) {
+	b := fillSentBuffer(10, 1, 2, 3)
+
+	_, failed, after := b.split(3)
+	if failed == nil {
+		t.Fatal("expected to find notification 3")
+	}
+	if len(after) != 0 {
+		t.Error("expected nothing to follow the last notification; got", len(after))
+	}
+}
+
+func TestSentBufferEvictsOldest(t *testing.T) {
+	b := newSentBuffer(3)
+	for i := int32(1); i <= 5; i++ {
+		pn := NewPushNotification()
+		pn.Identifier = i
+		evicted := b.add(pn, nil, sentEpoch)
+		if i > 3 && (evicted == nil || evicted.pn.Identifier != i-3) {
+			t.Error("expected unconfirmed notification", i-3, "to be evicted")
+		}
+	}
+
+	if b.count != 3 {
+		t.Fatal("expected 3 buffered notifications; got", b.count)
+	}
+
+	// Notification 1 has been evicted, so everything
+	// remembered must have been written after it.
+	_, failed, after := b.split(1)
+	if failed != nil {
+		t.Error("expected notification 1 to have been evicted")
+	}
+	if len(after) != 3 || after[0].pn.Identifier != 3 {
+		t.Error("expected notifications 3, 4 and 5 to be resent; got", after)
+	}
+}
+
+func TestSentBufferConfirm(t *testing.T) {
+	b := fillSentBuffer(10, 1, 2, 3, 4)
+
+	confirmed := b.confirm(sentEpoch.Add(2 * time.Second))
+	if len(confirmed) != 2 || confirmed[1].pn.Identifier != 2 {
+		t.Error("expected notifications 1 and 2 to be confirmed; got", confirmed)
+	}
+
+	// Only notification 4 follows the rejected one,
+	// and the earlier ones shouldn't be accepted twice.
+	accepted, failed, after := b.split(3)
+	if len(accepted) != 0 || failed == nil || len(after) != 1 {
+		t.Error("expected only notification 4 to follow 3; got", after)
+	}
+	if len(b.unconfirmed()) != 0 {
+		t.Error("expected no unconfirmed notifications after a split")
+	}
+}
+
+func TestSentBufferSplitConfirmed(t *testing.T) {
+	// Notifications 1 and 2 have already been reported as accepted,
+	// so they mustn't be resent or failed.
+	b := fillSentBuffer(10, 1, 2, 3, 4)
+	b.confirm(sentEpoch.Add(2 * time.Second))
+
+	accepted, failed, after := b.split(2)
+	if len(accepted) != 0 || failed != nil {
+		t.Error("expected confirmed notification 2 not to fail; got", accepted, failed)
+	}
+	if len(after) != 2 || after[0].pn.Identifier != 3 || after[1].pn.Identifier != 4 {
+		t.Error("expected only notifications 3 and 4 to be resent; got", after)
+	}
+
+	b = fillSentBuffer(10, 1, 2, 3, 4)
+	b.confirm(sentEpoch.Add(2 * time.Second))
+
+	_, failed, after = b.split(99)
+	if failed != nil {
+		t.Error("expected no notification 99")
+	}
+	if len(after) != 2 || after[0].pn.Identifier != 3 || after[1].pn.Identifier != 4 {
+		t.Error("expected only notifications 3 and 4 to be resent; got", after)
+	}
+}
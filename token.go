@@ -0,0 +1,132 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Apple refuses provider tokens more than an hour old, and
+// tokens refreshed more often than every 20 minutes.
+const (
+	tokenRefreshInterval = 50 * time.Minute
+	tokenMinimumLifetime = 20 * time.Minute
+)
+
+// ProviderToken signs the JSON Web Tokens an HTTP2Client can use to
+// authenticate with Apple instead of a certificate. A single signing
+// key, downloaded from Apple as a .p8 file, serves all of a team's
+// apps, identified by the key's ID and the team's ID.
+//
+// Each token is reused until it's nearly an hour old, when Apple
+// would reject it, and never replaced within 20 minutes of being
+// issued, as Apple asks. A ProviderToken is safe for concurrent use
+// by multiple goroutines.
+type ProviderToken struct {
+	KeyID  string
+	TeamID string
+
+	key *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	issued time.Time
+}
+
+// LoadProviderToken loads the .p8 signing key at the given path.
+func LoadProviderToken(keyFile, keyID, teamID string) (*ProviderToken, error) {
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return ParseProviderToken(keyPEM, keyID, teamID)
+}
+
+// ParseProviderToken is like LoadProviderToken, but takes the
+// contents of the .p8 file rather than its path.
+func ParseProviderToken(keyPEM []byte, keyID, teamID string) (*ProviderToken, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("failed to find a private key in PEM data")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok || ecKey.Curve != elliptic.P256() {
+		return nil, errors.New("provider token signing key must be an ECDSA P-256 key")
+	}
+	return &ProviderToken{KeyID: keyID, TeamID: teamID, key: ecKey}, nil
+}
+
+// Token returns the current token, signing a new one if it's
+// due to be refreshed.
+func (t *ProviderToken) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.token) > 0 && time.Since(t.issued) < tokenRefreshInterval {
+		return t.token, nil
+	}
+	now := time.Now()
+	token, err := t.sign(now)
+	if err != nil {
+		return "", err
+	}
+	t.token, t.issued = token, now
+	return token, nil
+}
+
+// renew discards the given token after Apple has said it expired,
+// reporting whether the next call to Token will return a different
+// one. That's not the case if it was issued too recently to be
+// replaced.
+func (t *ProviderToken) renew(expired string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != expired {
+		return true
+	}
+	if time.Since(t.issued) < tokenMinimumLifetime {
+		return false
+	}
+	t.token = ""
+	return true
+}
+
+// sign produces an ES256 JSON Web Token issued at the given time.
+func (t *ProviderToken) sign(issued time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": t.KeyID})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]interface{}{"iss": t.TeamID, "iat": issued.Unix()})
+	if err != nil {
+		return "", err
+	}
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, t.key, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	// JWS wants the two halves of the signature as fixed-size
+	// big-endian integers, back to back.
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
@@ -0,0 +1,138 @@
+package apns
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockProviderToken returns a provider token with a freshly generated
+// signing key, along with the key's public half.
+func mockProviderToken(t *testing.T) (*ProviderToken, *ecdsa.PublicKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := ParseProviderToken(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), "KEY1234567", "TEAM123456")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token, &key.PublicKey
+}
+
+func TestProviderTokenSignature(t *testing.T) {
+	token, public := mockProviderToken(t)
+	jwt, err := token.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		t.Fatal("expected a three part JWT; got", jwt)
+	}
+	var header, claims map[string]interface{}
+	headerJSON, _ := base64.RawURLEncoding.DecodeString(parts[0])
+	claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	json.Unmarshal(headerJSON, &header)
+	json.Unmarshal(claimsJSON, &claims)
+	if header["alg"] != "ES256" || header["kid"] != "KEY1234567" {
+		t.Error("expected an ES256 header with the key ID; got", header)
+	}
+	if claims["iss"] != "TEAM123456" || claims["iat"] == nil {
+		t.Error("expected the team ID and issue time as claims; got", claims)
+	}
+
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if len(signature) != 64 || !ecdsa.Verify(public, digest[:], r, s) {
+		t.Error("expected a valid signature")
+	}
+}
+
+func TestProviderTokenRefresh(t *testing.T) {
+	token, _ := mockProviderToken(t)
+	first, _ := token.Token()
+	if again, _ := token.Token(); again != first {
+		t.Error("expected the token to be reused")
+	}
+
+	// Too new to be replaced, even if Apple says it expired.
+	if token.renew(first) {
+		t.Error("expected a token issued just now not to be renewed")
+	}
+
+	token.issued = time.Now().Add(-tokenMinimumLifetime - time.Minute)
+	if !token.renew(first) {
+		t.Error("expected an older token to be renewed")
+	}
+	if renewed, _ := token.Token(); renewed == first {
+		t.Error("expected a new token after renewal")
+	}
+
+	token.issued = time.Now().Add(-tokenRefreshInterval)
+	current := token.token
+	if refreshed, _ := token.Token(); refreshed == current {
+		t.Error("expected the token to be refreshed before Apple's hour is up")
+	}
+}
+
+func TestParseProviderTokenWrongKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if _, err := ParseProviderToken(keyPEM, "KEY", "TEAM"); err == nil {
+		t.Error("expected a key that isn't P-256 to be refused")
+	}
+}
+
+func TestHTTP2TokenAuth(t *testing.T) {
+	var authorizations []string
+	c := newMockProvider(t, func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			t.Error("expected no client certificate with token authentication")
+		}
+		if r.Header.Get("apns-topic") != "com.example.app" {
+			t.Error("expected the topic header; got", r.Header.Get("apns-topic"))
+		}
+		authorizations = append(authorizations, r.Header.Get("authorization"))
+		if len(authorizations) == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"reason":"ExpiredProviderToken"}`))
+		}
+	})
+	c.Client.CertificateBase64, c.Client.KeyBase64 = "", ""
+	c.Token, _ = mockProviderToken(t)
+	c.Topic = "com.example.app"
+
+	// Old enough to be replaced when Apple says it has expired.
+	c.Token.Token()
+	c.Token.issued = time.Now().Add(-30 * time.Minute)
+
+	resp := c.Send(mockNotification(1))
+	if !resp.Success {
+		t.Fatal("expected the retry with a new token to succeed; got", resp.Error)
+	}
+	if len(authorizations) != 2 || !strings.HasPrefix(authorizations[0], "bearer ") || authorizations[0] == authorizations[1] {
+		t.Error("expected a retry with a different bearer token; got", authorizations)
+	}
+}